@@ -2,24 +2,35 @@ package main
 
 import (
 	"context"
+	"math"
 	"net"
 	"os"
 	"os/signal"
 	"strings"
 
-	"github.com/TriangleSide/CodebaseAI/pkg/ai/openai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/registry"
 	"github.com/TriangleSide/CodebaseAI/pkg/config"
 	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/chunks"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/patches"
 	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/search"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/templates"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/usage"
 	"github.com/TriangleSide/CodebaseAI/pkg/db/migrations"
+	"github.com/TriangleSide/CodebaseAI/pkg/fulltext"
 	"github.com/TriangleSide/CodebaseAI/pkg/handlers"
 	"github.com/TriangleSide/CodebaseAI/pkg/middleware"
+	"github.com/TriangleSide/CodebaseAI/pkg/retrieval"
+	"github.com/TriangleSide/CodebaseAI/pkg/watcher"
 	baseconfig "github.com/TriangleSide/GoTools/pkg/config"
 	"github.com/TriangleSide/GoTools/pkg/database/migration"
 	"github.com/TriangleSide/GoTools/pkg/http/api"
 	basemiddleware "github.com/TriangleSide/GoTools/pkg/http/middleware"
 	"github.com/TriangleSide/GoTools/pkg/http/server"
 	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
 	"github.com/TriangleSide/GoTools/pkg/validation"
 )
 
@@ -38,7 +49,7 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to process configuration (%s).", err)
 	}
-	logger.Infof("Using model version '%s'.", cfg.ModelVersion)
+	logger.Infof("Using provider '%s' with model version '%s'.", cfg.Provider, cfg.ModelVersion)
 
 	logger.Info("Connecting to the database.")
 	database, err := db.NewSQLiteDB()
@@ -54,9 +65,44 @@ func main() {
 
 	logger.Info("Creating the DAOs.")
 	projectDAO := projects.NewDAO(database.DB())
+	settingsDAO := settings.NewDAO(database.DB())
+	usageDAO := usage.NewDAO(database.DB())
+	chunksDAO := chunks.NewDAO(database.DB())
+	searchDAO := search.NewDAO(database.DB())
+	templateDAO := templates.NewDAO(database.DB())
+	patchDAO := patches.NewDAO(database.DB())
+
+	logger.Info("Watching the projects for changes.")
+	watcherManager := watcher.NewManager()
+	watchedProjects, err := projectDAO.List(ctx, &projects.ListParameters{Limit: ptr.Of(math.MaxInt32)})
+	if err != nil {
+		logger.Fatalf("Failed to list the projects (%s).", err)
+	}
+	for _, project := range watchedProjects {
+		if err := watcherManager.Watch(*project.Id, *project.Path); err != nil {
+			logger.Errorf("Failed to watch project %d (%s).", *project.Id, err)
+		}
+	}
+
+	logger.Info("Creating the AI providers.")
+	providerRegistry, err := registry.New(cfg)
+	if err != nil {
+		logger.Fatalf("Failed to create the AI providers (%s).", err)
+	}
 
-	logger.Info("Creating the OpenAI chat handler.")
-	aiChat := openai.NewOpenAIChat(cfg)
+	logger.Info("Creating the retrieval index.")
+	retrievalIndex, err := retrieval.New(cfg, chunksDAO, watcherManager)
+	if err != nil {
+		logger.Fatalf("Failed to create the retrieval index (%s).", err)
+	}
+
+	logger.Info("Creating the search index.")
+	if db.FTS5Enabled {
+		if err := searchDAO.CreateChunksTable(ctx); err != nil {
+			logger.Fatalf("Failed to create the search index table (%s).", err)
+		}
+	}
+	searchIndex := fulltext.New(searchDAO)
 
 	logger.Info("Configuring the common middleware.")
 	httpCommonMiddleware := []basemiddleware.Middleware{
@@ -65,9 +111,17 @@ func main() {
 
 	logger.Info("Configuring the API handlers.")
 	httpEndpointHandlers := []api.HTTPEndpointHandler{
-		handlers.NewAmalgam(projectDAO),
-		handlers.NewChat(aiChat),
-		handlers.NewProject(projectDAO),
+		handlers.NewAmalgam(projectDAO, settingsDAO),
+		handlers.NewChat(providerRegistry, retrievalIndex, projectDAO, settingsDAO, templateDAO, usageDAO),
+		handlers.NewEvents(projectDAO, watcherManager),
+		handlers.NewModels(providerRegistry),
+		handlers.NewPatches(projectDAO, patchDAO),
+		handlers.NewProject(projectDAO, searchIndex, watcherManager),
+		handlers.NewPrompt(projectDAO, settingsDAO),
+		handlers.NewSearch(projectDAO, settingsDAO, searchIndex),
+		handlers.NewSettings(projectDAO, settingsDAO),
+		handlers.NewTemplates(templateDAO),
+		handlers.NewUsage(usageDAO),
 	}
 
 	logger.Info("Creating the HTTP server.")
@@ -120,6 +174,12 @@ func main() {
 		logger.Errorf("Error shutting down the HTTP server (%s).", err)
 	}
 
+	logger.Info("Stopping the retrieval index updates.")
+	retrievalIndex.Close()
+
+	logger.Info("Stopping the project watchers.")
+	watcherManager.Close()
+
 	logger.Info("Closing the database connection.")
 	if err := database.Close(); err != nil {
 		logger.Errorf("Error closing the database connection (%s).", err)
@@ -6,8 +6,9 @@ toolchain go1.23.0
 
 require (
 	github.com/TriangleSide/GoTools v0.0.0-20241109195239-616cf2e53026
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-sqlite3 v1.14.24
-	github.com/sashabaranov/go-openai v1.32.5
+	github.com/sashabaranov/go-openai v1.38.1
 	github.com/tiktoken-go/tokenizer v0.2.0
 )
 
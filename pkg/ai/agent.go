@@ -0,0 +1,254 @@
+package ai
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	// maxToolOutputPreview is the length of the tool output reported to the client. The model gets all of it.
+	maxToolOutputPreview = 2000
+
+	// droppedToolOutput replaces the output of a tool call that no longer fits in the context window.
+	droppedToolOutput = "[The output of this call was dropped to fit the context window. Call the tool again if it is still needed.]"
+)
+
+// AgentInstructions are added to the system prompt in agent mode.
+//
+//go:embed agent.txt
+var AgentInstructions string
+
+// Tool is a function the model can call in agent mode. The parameters are the JSON schema of its arguments.
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+}
+
+// ToolCall is a call of a tool requested by the model. The arguments are a JSON object.
+type ToolCall struct {
+	Id        string
+	Name      string
+	Arguments string
+}
+
+// ToolResult is the output of a tool call, sent back to the model on the next step.
+type ToolResult struct {
+	CallId  string
+	Output  string
+	IsError bool
+}
+
+// AgentTurn is a reply of the model in agent mode, with the results of the tools it called.
+type AgentTurn struct {
+	Content   string
+	ToolCalls []*ToolCall
+	Results   []*ToolResult
+	Usage     *models.ChatUsage
+}
+
+// AgentStep is what the model is sent on every step of the agent loop.
+type AgentStep struct {
+	Request *models.ChatRequest
+	Tools   []*Tool
+	Turns   []*AgentTurn
+
+	// Final forbids tool calls, so the model answers with what it has read so far.
+	Final bool
+}
+
+// ToolChat is implemented by the providers that can call tools.
+type ToolChat interface {
+	// Step sends the conversation and the previous turns to the model and returns its next reply. Retries of the
+	// connection are announced on the stream.
+	Step(ctx context.Context, stream chan<- *models.ChatResponse, step *AgentStep) (*AgentTurn, error)
+}
+
+// ToolExecutor runs the tools called by the model.
+type ToolExecutor interface {
+	Tools() []*Tool
+	Execute(ctx context.Context, call *ToolCall) (string, error)
+}
+
+// RunAgent lets the model call tools until it answers, for at most maxSteps replies. Every tool call and its result are
+// streamed as their own messages, followed by the answer and a final message with the usage of all the steps. A
+// failing tool is reported to the model, which can try something else. When the context window of the model is known,
+// the outputs of the oldest tool calls are dropped from the steps that would not fit in it.
+func RunAgent(ctx context.Context, chat ToolChat, request *models.ChatRequest, executor ToolExecutor, maxSteps int, contextWindow int) <-chan *models.ChatResponse {
+	agentRequest := *request
+	agentRequest.Codebase = nil
+	agentRequest.CodebaseTokenCount = nil
+	agentRequest.Messages = make([]models.ChatMessage, 0, len(request.Messages)+1)
+	agentRequest.Messages = append(agentRequest.Messages, models.ChatMessage{Role: models.ChatRoleSystem, Content: AgentInstructions})
+	agentRequest.Messages = append(agentRequest.Messages, request.Messages...)
+
+	step := &AgentStep{
+		Request: &agentRequest,
+		Tools:   executor.Tools(),
+		Turns:   make([]*AgentTurn, 0),
+	}
+
+	stream := make(chan *models.ChatResponse)
+	go func() {
+		defer close(stream)
+
+		usage := &models.ChatUsage{}
+		for {
+			step.Final = len(step.Turns)+1 >= max(maxSteps, 1)
+			if dropped := fitTurns(step, contextWindow); dropped > 0 {
+				logger.Debugf("Dropped the output of %d tool calls to fit the agent in the context window.", dropped)
+			}
+			turn, err := chat.Step(ctx, stream, step)
+			if err != nil {
+				msg := &models.ChatResponse{Done: ptr.Of(true), Error: ptr.Of(fmt.Sprintf("Error in step %d of the agent (%s).", len(step.Turns)+1, err.Error()))}
+				// The steps that succeeded were billed by the provider.
+				if len(step.Turns) > 0 {
+					msg.Usage = usage
+				}
+				_ = SendOverChannel(ctx, stream, msg)
+				return
+			}
+			addUsage(usage, turn.Usage)
+
+			if len(turn.ToolCalls) == 0 || step.Final {
+				if turn.Content != "" && !SendOverChannel(ctx, stream, &models.ChatResponse{Content: ptr.Of(turn.Content)}) {
+					return
+				}
+				_ = SendOverChannel(ctx, stream, &models.ChatResponse{Done: ptr.Of(true), Usage: usage})
+				return
+			}
+
+			// What the model says while calling tools is part of the reply.
+			if turn.Content != "" && !SendOverChannel(ctx, stream, &models.ChatResponse{Content: ptr.Of(turn.Content + "\n\n")}) {
+				return
+			}
+			for _, call := range turn.ToolCalls {
+				result, ok := runTool(ctx, stream, executor, call)
+				if !ok {
+					return
+				}
+				turn.Results = append(turn.Results, result)
+			}
+			step.Turns = append(step.Turns, turn)
+		}
+	}()
+
+	return stream
+}
+
+// runTool executes a tool call and streams the call and its result. It returns false if the client went away.
+func runTool(ctx context.Context, stream chan<- *models.ChatResponse, executor ToolExecutor, call *ToolCall) (*ToolResult, bool) {
+	toolCall := &models.ChatToolCall{
+		Id:        call.Id,
+		Name:      call.Name,
+		Arguments: call.Arguments,
+	}
+	if !SendOverChannel(ctx, stream, &models.ChatResponse{ToolCall: toolCall}) {
+		return nil, false
+	}
+
+	result := &ToolResult{CallId: call.Id}
+	toolResult := &models.ChatToolResult{
+		Id:   call.Id,
+		Name: call.Name,
+	}
+	output, err := executor.Execute(ctx, call)
+	if err != nil {
+		logger.Debugf("The tool %s failed (%s).", call.Name, err.Error())
+		result.Output = err.Error()
+		result.IsError = true
+		toolResult.Error = ptr.Of(err.Error())
+	} else {
+		result.Output = output
+		toolResult.Output = output
+		if len(output) > maxToolOutputPreview {
+			toolResult.Output = output[:maxToolOutputPreview]
+			toolResult.Truncated = true
+		}
+	}
+
+	return result, SendOverChannel(ctx, stream, &models.ChatResponse{ToolResult: toolResult})
+}
+
+// fitTurns replaces the outputs of the oldest tool calls with a note until the step fits in the context window, and
+// returns how many were replaced. The outputs of the latest turn are kept, since the model has not seen them yet.
+func fitTurns(step *AgentStep, contextWindow int) int {
+	if contextWindow <= 0 || len(step.Turns) < 2 {
+		return 0
+	}
+	model := modelOf(step.Request)
+	budget := contextWindow - reservedOutputTokens(step.Request.Generation)
+	used := stepTokens(model, step)
+
+	dropped := 0
+	for _, turn := range step.Turns[:len(step.Turns)-1] {
+		for _, result := range turn.Results {
+			if used <= budget {
+				return dropped
+			}
+			if result.Output == droppedToolOutput {
+				continue
+			}
+			used -= CountTokens(model, result.Output) - CountTokens(model, droppedToolOutput)
+			result.Output = droppedToolOutput
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// EstimateStepUsage counts the tokens of a step of the agent and of its reply locally, for providers that do not report
+// their usage. The prompt includes the tools and the previous turns with their tool calls and results.
+func EstimateStepUsage(model string, step *AgentStep, reply string) *models.ChatUsage {
+	return &models.ChatUsage{
+		PromptTokens:     stepTokens(model, step),
+		CompletionTokens: CountTokens(model, reply),
+		Estimated:        true,
+	}
+}
+
+// stepTokens returns the amount of tokens of everything sent to the model on a step.
+func stepTokens(model string, step *AgentStep) int {
+	tokens := contextTokens(model, step.Request)
+	for _, message := range step.Request.Messages {
+		tokens += countMessage(model, message)
+	}
+	for _, tool := range step.Tools {
+		parameters, _ := json.Marshal(tool.Parameters)
+		tokens += CountTokens(model, tool.Name+" "+tool.Description+" "+string(parameters)) + messageOverheadTokens
+	}
+	for _, turn := range step.Turns {
+		tokens += CountTokens(model, turn.Content) + messageOverheadTokens
+		for _, call := range turn.ToolCalls {
+			tokens += CountTokens(model, call.Name+" "+call.Arguments) + messageOverheadTokens
+		}
+		for _, result := range turn.Results {
+			tokens += CountTokens(model, result.Output) + messageOverheadTokens
+		}
+	}
+	return tokens
+}
+
+// modelOf returns the model selected by a request, which the registry always sets.
+func modelOf(request *models.ChatRequest) string {
+	if request.Model != nil {
+		return *request.Model
+	}
+	return ""
+}
+
+func addUsage(total *models.ChatUsage, usage *models.ChatUsage) {
+	if usage == nil {
+		return
+	}
+	total.PromptTokens += usage.PromptTokens
+	total.CompletionTokens += usage.CompletionTokens
+	total.CachedTokens += usage.CachedTokens
+	total.Estimated = total.Estimated || usage.Estimated
+}
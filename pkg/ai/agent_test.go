@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	testModel = "gpt-4o"
+)
+
+func agentStep(outputs ...string) *AgentStep {
+	step := &AgentStep{
+		Request: &models.ChatRequest{
+			Model:    ptr.Of(testModel),
+			Messages: []models.ChatMessage{{Role: models.ChatRoleUser, Content: "Where is the configuration read?"}},
+		},
+		Tools: []*Tool{{Name: "read_file", Description: "Reads a file.", Parameters: map[string]any{"type": "object"}}},
+	}
+	for i, output := range outputs {
+		callId := string(rune('a' + i))
+		step.Turns = append(step.Turns, &AgentTurn{
+			ToolCalls: []*ToolCall{{Id: callId, Name: "read_file", Arguments: `{"path":"main.go"}`}},
+			Results:   []*ToolResult{{CallId: callId, Output: output}},
+		})
+	}
+	return step
+}
+
+func TestEstimateStepUsageCountsTheTurns(t *testing.T) {
+	withoutTurns := EstimateStepUsage(testModel, agentStep(), "answer")
+	withTurns := EstimateStepUsage(testModel, agentStep(strings.Repeat("word ", 500)), "answer")
+
+	if !withTurns.Estimated {
+		t.Fatal("expected the usage to be estimated")
+	}
+	if withTurns.PromptTokens < withoutTurns.PromptTokens+500 {
+		t.Fatalf("expected the tool output to be counted, got %d tokens without it and %d with it", withoutTurns.PromptTokens, withTurns.PromptTokens)
+	}
+	if withTurns.CompletionTokens != CountTokens(testModel, "answer") {
+		t.Fatalf("unexpected completion tokens %d", withTurns.CompletionTokens)
+	}
+}
+
+func TestFitTurns(t *testing.T) {
+	large := strings.Repeat("word ", 2000)
+
+	testCases := []struct {
+		name          string
+		contextWindow int
+		dropped       int
+	}{
+		{name: "unknown context window", contextWindow: 0, dropped: 0},
+		{name: "everything fits", contextWindow: 100000, dropped: 0},
+		{name: "the oldest output is dropped", contextWindow: defaultReservedOutputTokens + 4500, dropped: 1},
+		{name: "every output but the latest is dropped", contextWindow: defaultReservedOutputTokens + 100, dropped: 2},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			step := agentStep(large, large, large)
+			dropped := fitTurns(step, testCase.contextWindow)
+			if dropped != testCase.dropped {
+				t.Fatalf("expected %d dropped outputs, got %d", testCase.dropped, dropped)
+			}
+			for i, turn := range step.Turns {
+				expected := large
+				if i < testCase.dropped {
+					expected = droppedToolOutput
+				}
+				if turn.Results[0].Output != expected {
+					t.Fatalf("unexpected output of turn %d", i)
+				}
+			}
+		})
+	}
+}
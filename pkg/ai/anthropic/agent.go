@@ -0,0 +1,197 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	blockText       = "text"
+	blockToolUse    = "tool_use"
+	blockToolResult = "tool_result"
+
+	// toolChoiceNone forbids tool calls on the final step of the agent.
+	toolChoiceNone = "none"
+)
+
+// contentBlock is a part of a message. The fields used depend on the type of the block.
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	Id        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseId string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+type blockMessage struct {
+	Role    string          `json:"role"`
+	Content []*contentBlock `json:"content"`
+}
+
+type toolDefinition struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type toolChoice struct {
+	Type string `json:"type"`
+}
+
+// toolsRequest is a messages request with tools. Its messages replace the text messages of the embedded request.
+type toolsRequest struct {
+	*messagesRequest
+	Messages   []*blockMessage   `json:"messages"`
+	Tools      []*toolDefinition `json:"tools"`
+	ToolChoice *toolChoice       `json:"tool_choice,omitempty"`
+}
+
+type messagesResponse struct {
+	Content []*contentBlock `json:"content"`
+	Usage   *usage          `json:"usage"`
+}
+
+// Step sends the conversation, the previous tool calls and their results, and returns the next reply of the model.
+func (model *anthropicChat) Step(ctx context.Context, stream chan<- *models.ChatResponse, step *ai.AgentStep) (*ai.AgentTurn, error) {
+	system, messages := convertMessages(ai.SystemPrompt(step.Request), ai.Conversation(step.Request))
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("the chat request has no user message")
+	}
+
+	messagesReq := &messagesRequest{
+		Model:     model.modelFor(step.Request),
+		System:    system,
+		MaxTokens: defaultMaxTokens,
+	}
+	if err := applyGeneration(messagesReq, step.Request.Generation); err != nil {
+		return nil, err
+	}
+	if messagesReq.Thinking != nil {
+		// The thinking blocks would have to be sent back with every tool result, so the agent does not think.
+		logger.Debug("Extended thinking is not used in agent mode, ignoring the reasoning effort.")
+		messagesReq.MaxTokens -= messagesReq.Thinking.BudgetTokens
+		messagesReq.Thinking = nil
+	}
+
+	req := &toolsRequest{
+		messagesRequest: messagesReq,
+		Messages:        make([]*blockMessage, 0, len(messages)+2*len(step.Turns)),
+		Tools:           make([]*toolDefinition, 0, len(step.Tools)),
+	}
+	for _, msg := range messages {
+		req.Messages = append(req.Messages, &blockMessage{
+			Role:    msg.Role,
+			Content: []*contentBlock{{Type: blockText, Text: msg.Content}},
+		})
+	}
+	for _, turn := range step.Turns {
+		req.Messages = append(req.Messages, turnMessages(turn)...)
+	}
+	for _, tool := range step.Tools {
+		req.Tools = append(req.Tools, &toolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+	if step.Final {
+		req.ToolChoice = &toolChoice{Type: toolChoiceNone}
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the messages request (%w)", err)
+	}
+
+	response, err := ai.Connect(ctx, model.retryPolicy, stream, func() (*messagesResponse, error) {
+		httpResponse, err := model.send(ctx, body)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err := httpResponse.Body.Close(); err != nil {
+				logger.Errorf("Failed to close Anthropic response (%s).", err.Error())
+			}
+		}()
+		responseBody, err := io.ReadAll(httpResponse.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the Anthropic response (%w)", err)
+		}
+		response := &messagesResponse{}
+		if err := json.Unmarshal(responseBody, response); err != nil {
+			return nil, fmt.Errorf("error decoding the Anthropic response (%w)", err)
+		}
+		return response, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling Anthropic (%w)", err)
+	}
+
+	turn := &ai.AgentTurn{}
+	text := make([]string, 0)
+	for _, block := range response.Content {
+		switch block.Type {
+		case blockText:
+			text = append(text, block.Text)
+		case blockToolUse:
+			turn.ToolCalls = append(turn.ToolCalls, &ai.ToolCall{
+				Id:        block.Id,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
+	}
+	turn.Content = strings.Join(text, "\n\n")
+	if u := response.Usage; u != nil {
+		turn.Usage = &models.ChatUsage{
+			PromptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+			CompletionTokens: u.OutputTokens,
+			CachedTokens:     u.CacheReadInputTokens,
+		}
+	} else {
+		turn.Usage = ai.EstimateStepUsage(messagesReq.Model, step, turn.Content)
+	}
+	return turn, nil
+}
+
+// turnMessages maps a turn of the agent to the assistant message with its tool calls, followed by the user message
+// with their results.
+func turnMessages(turn *ai.AgentTurn) []*blockMessage {
+	assistant := &blockMessage{Role: roleAssistant}
+	if content := strings.TrimSpace(turn.Content); content != "" {
+		assistant.Content = append(assistant.Content, &contentBlock{Type: blockText, Text: content})
+	}
+	for _, call := range turn.ToolCalls {
+		input := json.RawMessage(call.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		assistant.Content = append(assistant.Content, &contentBlock{
+			Type:  blockToolUse,
+			Id:    call.Id,
+			Name:  call.Name,
+			Input: input,
+		})
+	}
+
+	results := &blockMessage{Role: roleUser}
+	for _, result := range turn.Results {
+		results.Content = append(results.Content, &contentBlock{
+			Type:      blockToolResult,
+			ToolUseId: result.CallId,
+			Content:   result.Output,
+			IsError:   result.IsError,
+		})
+	}
+	return []*blockMessage{assistant, results}
+}
@@ -0,0 +1,272 @@
+package anthropic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/cassette"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	messagesPath = "/v1/messages"
+	apiVersion   = "2023-06-01"
+
+	// defaultMaxTokens is the limit on the length of a reply. The Messages API requires one on every request.
+	defaultMaxTokens = 8192
+
+	// maxTemperature is lower than the limit of the other providers.
+	maxTemperature = 1.0
+
+	roleUser      = "user"
+	roleAssistant = "assistant"
+	roleSystem    = "system"
+)
+
+// thinkingBudgets are the extended thinking budgets of the reasoning efforts, in tokens.
+var thinkingBudgets = map[string]int{
+	ai.ReasoningEffortLow:    1024,
+	ai.ReasoningEffortMedium: 4096,
+	ai.ReasoningEffortHigh:   16384,
+}
+
+type anthropicChat struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+	model   string
+
+	retryPolicy *ai.RetryPolicy
+}
+
+func NewAnthropicChat(cfg *config.Config) (ai.Chat, error) {
+	apiKey := cfg.ProviderApiKey(config.ProviderAnthropic)
+	if apiKey == "" {
+		return nil, fmt.Errorf("an API key is required for the Anthropic provider")
+	}
+	transport, err := cassette.NewTransport(cfg, http.DefaultTransport)
+	if err != nil {
+		return nil, err
+	}
+	return &anthropicChat{
+		client:  &http.Client{Transport: transport},
+		baseURL: strings.TrimSuffix(cfg.AnthropicBaseUrl, "/"),
+		apiKey:  apiKey,
+		model:   cfg.ModelVersion,
+
+		retryPolicy: ai.NewRetryPolicy(cfg),
+	}, nil
+}
+
+type message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type thinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type messagesRequest struct {
+	Model         string     `json:"model"`
+	System        string     `json:"system,omitempty"`
+	Messages      []*message `json:"messages"`
+	MaxTokens     int        `json:"max_tokens"`
+	Temperature   *float64   `json:"temperature,omitempty"`
+	TopP          *float64   `json:"top_p,omitempty"`
+	StopSequences []string   `json:"stop_sequences,omitempty"`
+	Thinking      *thinking  `json:"thinking,omitempty"`
+	Stream        bool       `json:"stream"`
+}
+
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error apiError `json:"error"`
+}
+
+func (model *anthropicChat) Stream(ctx context.Context, request *models.ChatRequest) (tokens <-chan *models.ChatResponse, err error) {
+	system, messages := convertMessages(ai.SystemPrompt(request), ai.Conversation(request))
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("the chat request has no user message")
+	}
+
+	messagesReq := &messagesRequest{
+		Model:     model.modelFor(request),
+		System:    system,
+		Messages:  messages,
+		MaxTokens: defaultMaxTokens,
+		Stream:    true,
+	}
+	if err := applyGeneration(messagesReq, request.Generation); err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(messagesReq)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding the messages request (%w)", err)
+	}
+
+	tokenStream := make(chan *models.ChatResponse)
+
+	go func() {
+		defer close(tokenStream)
+
+		response, err := ai.Connect(ctx, model.retryPolicy, tokenStream, func() (*http.Response, error) {
+			return model.send(ctx, body)
+		})
+		if err != nil {
+			_ = ai.SendOverChannel(ctx, tokenStream, &models.ChatResponse{Done: ptr.Of(true), Error: ptr.Of(fmt.Sprintf("Error connecting to Anthropic (%s).", err.Error()))})
+			return
+		}
+		defer func() {
+			if err := response.Body.Close(); err != nil {
+				logger.Errorf("Failed to close Anthropic stream (%s).", err.Error())
+			}
+		}()
+
+		reply := strings.Builder{}
+		usage, streamErr := readEvents(response.Body, func(text string) bool {
+			reply.WriteString(text)
+			return ai.SendOverChannel(ctx, tokenStream, &models.ChatResponse{Content: ptr.Of(text)})
+		})
+		msg := &models.ChatResponse{Done: ptr.Of(true)}
+		if streamErr != nil {
+			msg.Error = ptr.Of(streamErr.Error())
+		} else {
+			if usage == nil {
+				usage = ai.EstimateUsage(messagesReq.Model, request, reply.String())
+			}
+			msg.Usage = usage
+		}
+		_ = ai.SendOverChannel(ctx, tokenStream, msg)
+	}()
+
+	return tokenStream, nil
+}
+
+// applyGeneration maps the generation options to the request. The reasoning effort turns on extended thinking with a
+// budget on top of the output limit, and thinking does not allow changing the sampling. The error is an
+// *ai.ValidationError.
+func applyGeneration(req *messagesRequest, options *models.GenerationOptions) error {
+	if options == nil {
+		return nil
+	}
+	if options.Temperature != nil && *options.Temperature > maxTemperature {
+		return &ai.ValidationError{Err: fmt.Errorf("the temperature must be at most %g for Anthropic models", maxTemperature)}
+	}
+	if options.Seed != nil {
+		logger.Debug("Anthropic models do not support a seed, ignoring it.")
+	}
+
+	req.Temperature = options.Temperature
+	req.TopP = options.TopP
+	req.StopSequences = options.Stop
+	if options.MaxOutputTokens != nil {
+		req.MaxTokens = *options.MaxOutputTokens
+	}
+
+	if options.ReasoningEffort != nil {
+		if req.Temperature != nil || req.TopP != nil {
+			return &ai.ValidationError{Err: fmt.Errorf("the temperature and top_p cannot be set with a reasoning effort for Anthropic models")}
+		}
+		budget := thinkingBudgets[*options.ReasoningEffort]
+		req.Thinking = &thinking{Type: "enabled", BudgetTokens: budget}
+		req.MaxTokens += budget
+	}
+	return nil
+}
+
+// modelFor returns the model selected by the request, or the configured model if there is none.
+func (model *anthropicChat) modelFor(request *models.ChatRequest) string {
+	if request.Model != nil {
+		return *request.Model
+	}
+	return model.model
+}
+
+// send posts the request to the Messages API. Responses other than 200 are turned into an ai.StatusError.
+func (model *anthropicChat) send(ctx context.Context, body []byte) (*http.Response, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, model.baseURL+messagesPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("Accept", "text/event-stream")
+	httpRequest.Header.Set("X-Api-Key", model.apiKey)
+	httpRequest.Header.Set("Anthropic-Version", apiVersion)
+
+	response, err := model.client.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusOK {
+		return response, nil
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			logger.Errorf("Failed to close Anthropic response (%s).", err.Error())
+		}
+	}()
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	statusErr := &ai.StatusError{
+		StatusCode: response.StatusCode,
+		RetryAfter: ai.ParseRetryAfter(response.Header.Get("Retry-After")),
+	}
+	errResponse := &errorResponse{}
+	if err := json.Unmarshal(responseBody, errResponse); err == nil && errResponse.Error.Message != "" {
+		statusErr.Err = fmt.Errorf("status %d, %s: %s", response.StatusCode, errResponse.Error.Type, errResponse.Error.Message)
+	} else {
+		statusErr.Err = fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+	return nil, statusErr
+}
+
+// convertMessages maps the chat messages to the Messages API. System messages are moved to the top-level system
+// prompt after the given one, consecutive messages of the same role are merged since the roles must alternate, and
+// the conversation is made to start with a user message.
+func convertMessages(systemPrompt string, chatMessages []models.ChatMessage) (string, []*message) {
+	systemParts := []string{strings.TrimSpace(systemPrompt)}
+	messages := make([]*message, 0, len(chatMessages))
+
+	for _, chatMessage := range chatMessages {
+		content := strings.TrimSpace(chatMessage.Content)
+		if content == "" {
+			continue
+		}
+		switch chatMessage.Role {
+		case roleSystem:
+			systemParts = append(systemParts, content)
+			continue
+		case roleUser, roleAssistant:
+		default:
+			logger.Warnf("Skipping chat message with unknown role '%s'.", chatMessage.Role)
+			continue
+		}
+
+		if len(messages) == 0 && chatMessage.Role != roleUser {
+			continue
+		}
+		if last := len(messages) - 1; last >= 0 && messages[last].Role == chatMessage.Role {
+			messages[last].Content += "\n\n" + content
+			continue
+		}
+		messages = append(messages, &message{Role: chatMessage.Role, Content: content})
+	}
+
+	return strings.Join(systemParts, "\n\n"), messages
+}
@@ -0,0 +1,330 @@
+package anthropic
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	testApiKey = "test-key"
+	testModel  = "claude-test"
+)
+
+func sse(events ...string) string {
+	sb := strings.Builder{}
+	for _, event := range events {
+		sb.WriteString(fmt.Sprintf("event: message\ndata: %s\n\n", event))
+	}
+	return sb.String()
+}
+
+var (
+	messageStart = `{"type":"message_start","message":{"usage":{"input_tokens":10,"output_tokens":1,"cache_read_input_tokens":4}}}`
+	helloDelta   = `{"type":"content_block_delta","delta":{"type":"text_delta","text":"Hello"}}`
+	worldDelta   = `{"type":"content_block_delta","delta":{"type":"text_delta","text":" world"}}`
+	messageDelta = `{"type":"message_delta","usage":{"output_tokens":7}}`
+	messageStop  = `{"type":"message_stop"}`
+	overloaded   = `{"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`
+)
+
+func TestReadEvents(t *testing.T) {
+	testCases := []struct {
+		name      string
+		stream    string
+		text      string
+		usage     *models.ChatUsage
+		errorText string
+	}{
+		{
+			name:   "text deltas",
+			stream: sse(messageStart, helloDelta, worldDelta, messageDelta, messageStop),
+			text:   "Hello world",
+			usage:  &models.ChatUsage{PromptTokens: 14, CompletionTokens: 7, CachedTokens: 4},
+		},
+		{
+			name:      "error event",
+			stream:    sse(messageStart, helloDelta, overloaded),
+			text:      "Hello",
+			usage:     &models.ChatUsage{PromptTokens: 14, CompletionTokens: 1, CachedTokens: 4},
+			errorText: "overloaded_error: Overloaded",
+		},
+		{
+			name:      "truncated stream",
+			stream:    sse(messageStart, helloDelta),
+			text:      "Hello",
+			usage:     &models.ChatUsage{PromptTokens: 14, CompletionTokens: 1, CachedTokens: 4},
+			errorText: "ended before the message was complete",
+		},
+		{
+			name:      "invalid event",
+			stream:    "data: {\n\n",
+			errorText: "error decoding Anthropic event",
+		},
+		{
+			name:   "no usage",
+			stream: sse(helloDelta, messageStop),
+			text:   "Hello",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			text := strings.Builder{}
+			usage, err := readEvents(strings.NewReader(testCase.stream), func(delta string) bool {
+				text.WriteString(delta)
+				return true
+			})
+			if testCase.errorText == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if testCase.errorText != "" && (err == nil || !strings.Contains(err.Error(), testCase.errorText)) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.errorText, err)
+			}
+			if text.String() != testCase.text {
+				t.Fatalf("expected text %q, got %q", testCase.text, text.String())
+			}
+			if (usage == nil) != (testCase.usage == nil) || (usage != nil && *usage != *testCase.usage) {
+				t.Fatalf("expected usage %+v, got %+v", testCase.usage, usage)
+			}
+		})
+	}
+}
+
+func TestReadEventsStopsWhenOnTextReturnsFalse(t *testing.T) {
+	calls := 0
+	_, err := readEvents(strings.NewReader(sse(helloDelta, worldDelta, messageStop)), func(string) bool {
+		calls++
+		return false
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single text delta, got %d", calls)
+	}
+}
+
+func newTestChat(t *testing.T, handler http.HandlerFunc) *anthropicChat {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	chat, err := NewAnthropicChat(&config.Config{
+		Provider:         config.ProviderAnthropic,
+		AnthropicApiKey:  testApiKey,
+		AnthropicBaseUrl: server.URL + "/",
+		ModelVersion:     testModel,
+		RetryMaxAttempts: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create the chat (%s)", err)
+	}
+	return chat.(*anthropicChat)
+}
+
+func collect(t *testing.T, tokens <-chan *models.ChatResponse) (string, *models.ChatResponse) {
+	t.Helper()
+	text := strings.Builder{}
+	for token := range tokens {
+		if token.Content != nil {
+			text.WriteString(*token.Content)
+		}
+		if token.Done != nil && *token.Done {
+			return text.String(), token
+		}
+	}
+	t.Fatal("the stream ended without a done message")
+	return "", nil
+}
+
+func chatRequest() *models.ChatRequest {
+	return &models.ChatRequest{
+		Messages: []models.ChatMessage{{Role: models.ChatRoleUser, Content: "Say hello."}},
+	}
+}
+
+func TestStream(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		body      string
+		text      string
+		usage     *models.ChatUsage
+		errorText string
+	}{
+		{
+			name:   "text deltas",
+			status: http.StatusOK,
+			body:   sse(messageStart, helloDelta, worldDelta, messageDelta, messageStop),
+			text:   "Hello world",
+			usage:  &models.ChatUsage{PromptTokens: 14, CompletionTokens: 7, CachedTokens: 4},
+		},
+		{
+			name:      "error event",
+			status:    http.StatusOK,
+			body:      sse(messageStart, helloDelta, overloaded),
+			text:      "Hello",
+			errorText: "overloaded_error: Overloaded",
+		},
+		{
+			name:      "truncated stream",
+			status:    http.StatusOK,
+			body:      sse(messageStart, helloDelta),
+			text:      "Hello",
+			errorText: "ended before the message was complete",
+		},
+		{
+			name:      "error response",
+			status:    http.StatusBadRequest,
+			body:      `{"type":"error","error":{"type":"invalid_request_error","message":"max_tokens is too large"}}`,
+			errorText: "status 400, invalid_request_error: max_tokens is too large",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			chat := newTestChat(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != messagesPath {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				if r.Header.Get("X-Api-Key") != testApiKey || r.Header.Get("Anthropic-Version") != apiVersion {
+					t.Errorf("unexpected headers %v", r.Header)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.WriteHeader(testCase.status)
+				_, _ = w.Write([]byte(testCase.body))
+			})
+
+			tokens, err := chat.Stream(context.Background(), chatRequest())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			text, done := collect(t, tokens)
+			if text != testCase.text {
+				t.Fatalf("expected text %q, got %q", testCase.text, text)
+			}
+			if testCase.errorText == "" {
+				if done.Error != nil {
+					t.Fatalf("unexpected error: %s", *done.Error)
+				}
+				if done.Usage == nil || *done.Usage != *testCase.usage {
+					t.Fatalf("expected usage %+v, got %+v", testCase.usage, done.Usage)
+				}
+			} else if done.Error == nil || !strings.Contains(*done.Error, testCase.errorText) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.errorText, done.Error)
+			}
+		})
+	}
+}
+
+func TestStreamEstimatesUsageWhenTheStreamHasNone(t *testing.T) {
+	chat := newTestChat(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(sse(helloDelta, messageStop)))
+	})
+
+	request := chatRequest()
+	request.Model = ptr.Of(testModel)
+	tokens, err := chat.Stream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, done := collect(t, tokens)
+	if done.Usage == nil || !done.Usage.Estimated || done.Usage.PromptTokens == 0 {
+		t.Fatalf("expected an estimated usage, got %+v", done.Usage)
+	}
+}
+
+func TestStreamRetries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		requests  int32
+		statuses  []*models.ChatStatus
+		errorText string
+	}{
+		{
+			name:     "rate limit with Retry-After",
+			status:   http.StatusTooManyRequests,
+			requests: 2,
+			statuses: []*models.ChatStatus{{Type: ai.ChatStatusRetrying, Attempt: 2, MaxAttempts: 3, DelayMs: 50}},
+		},
+		{
+			name:     "overloaded",
+			status:   529,
+			requests: 2,
+			statuses: []*models.ChatStatus{{Type: ai.ChatStatusRetrying, Attempt: 2, MaxAttempts: 3, DelayMs: 50}},
+		},
+		{
+			name:      "client error",
+			status:    http.StatusBadRequest,
+			requests:  1,
+			errorText: "status 400, rate_limit_error: try again later",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			requests := &atomic.Int32{}
+			chat := newTestChat(t, func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(testCase.status)
+					_, _ = w.Write([]byte(`{"type":"error","error":{"type":"rate_limit_error","message":"try again later"}}`))
+					return
+				}
+				_, _ = w.Write([]byte(sse(messageStart, helloDelta, messageDelta, messageStop)))
+			})
+			// Without a base delay the backoff is zero, so a delay can only come from the Retry-After header, cut to
+			// the maximum delay.
+			chat.retryPolicy = &ai.RetryPolicy{MaxAttempts: 3, MaxDelay: 50 * time.Millisecond}
+
+			tokens, err := chat.Stream(context.Background(), chatRequest())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			statuses := make([]*models.ChatStatus, 0)
+			var done *models.ChatResponse
+			for token := range tokens {
+				if token.Status != nil {
+					token.Status.Message = ""
+					statuses = append(statuses, token.Status)
+				}
+				if token.Done != nil {
+					done = token
+				}
+			}
+
+			if requests.Load() != testCase.requests {
+				t.Fatalf("expected %d requests, got %d", testCase.requests, requests.Load())
+			}
+			if len(statuses) != len(testCase.statuses) {
+				t.Fatalf("expected %d status messages, got %d", len(testCase.statuses), len(statuses))
+			}
+			for i, status := range statuses {
+				if *status != *testCase.statuses[i] {
+					t.Fatalf("expected the status %+v, got %+v", testCase.statuses[i], status)
+				}
+			}
+			if done == nil {
+				t.Fatal("the stream ended without a done message")
+			}
+			if testCase.errorText == "" && done.Error != nil {
+				t.Fatalf("unexpected error: %s", *done.Error)
+			}
+			if testCase.errorText != "" && (done.Error == nil || !strings.Contains(*done.Error, testCase.errorText)) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.errorText, done.Error)
+			}
+		})
+	}
+}
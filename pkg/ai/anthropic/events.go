@@ -0,0 +1,98 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	eventMessageStart      = "message_start"
+	eventMessageDelta      = "message_delta"
+	eventContentBlockDelta = "content_block_delta"
+	eventMessageStop       = "message_stop"
+	eventError             = "error"
+
+	deltaText = "text_delta"
+
+	// maxEventSize is the largest line accepted in the event stream.
+	maxEventSize = 1 << 20
+)
+
+type usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+type streamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage *usage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage *usage   `json:"usage"`
+	Error apiError `json:"error"`
+}
+
+// readEvents parses the server-sent events of a streamed Messages API response and calls onText for every text delta.
+// It stops early when onText returns false. It returns the usage reported by the stream, which is nil if there was
+// none, and an error if the stream reports one or ends before the message is complete.
+func readEvents(reader io.Reader, onText func(text string) bool) (*models.ChatUsage, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+
+	var chatUsage *models.ChatUsage
+
+	for scanner.Scan() {
+		data, isData := strings.CutPrefix(scanner.Text(), "data:")
+		if !isData {
+			continue
+		}
+
+		event := &streamEvent{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), event); err != nil {
+			return chatUsage, fmt.Errorf("error decoding Anthropic event (%w)", err)
+		}
+
+		switch event.Type {
+		case eventMessageStart:
+			if u := event.Message.Usage; u != nil {
+				// The prompt tokens of the Messages API exclude the cached ones, which are counted separately.
+				chatUsage = &models.ChatUsage{
+					PromptTokens:     u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens,
+					CompletionTokens: u.OutputTokens,
+					CachedTokens:     u.CacheReadInputTokens,
+				}
+			}
+		case eventMessageDelta:
+			// The output tokens of a message delta are cumulative.
+			if event.Usage != nil && chatUsage != nil {
+				chatUsage.CompletionTokens = event.Usage.OutputTokens
+			}
+		case eventContentBlockDelta:
+			if event.Delta.Type == deltaText && event.Delta.Text != "" {
+				if !onText(event.Delta.Text) {
+					return chatUsage, nil
+				}
+			}
+		case eventMessageStop:
+			return chatUsage, nil
+		case eventError:
+			return chatUsage, fmt.Errorf("%s: %s", event.Error.Type, event.Error.Message)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return chatUsage, fmt.Errorf("error reading Anthropic stream (%w)", err)
+	}
+
+	return chatUsage, fmt.Errorf("the Anthropic stream ended before the message was complete")
+}
@@ -0,0 +1,173 @@
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+
+	// fileExtension is the extension of the cassettes, which hold an HTTP response as it is sent over the wire.
+	fileExtension = ".http"
+)
+
+// transport records the HTTP responses of a provider to a directory, or replays them from it without calling the
+// provider. A response is stored under the hash of the method, the path and the body of its request, so the same
+// request replays the same response, byte for byte.
+type transport struct {
+	base      http.RoundTripper
+	directory string
+	mode      string
+}
+
+// NewTransport wraps the transport of a provider in a cassette of the configured mode. The base transport is returned
+// as is when no mode is configured.
+func NewTransport(cfg *config.Config, base http.RoundTripper) (http.RoundTripper, error) {
+	switch cfg.CassetteMode {
+	case "":
+		return base, nil
+	case ModeRecord:
+		if err := os.MkdirAll(cfg.CassetteDir, 0o755); err != nil {
+			return nil, fmt.Errorf("error creating the cassette directory %s (%w)", cfg.CassetteDir, err)
+		}
+	case ModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode '%s'", cfg.CassetteMode)
+	}
+	return &transport{
+		base:      base,
+		directory: cfg.CassetteDir,
+		mode:      cfg.CassetteMode,
+	}, nil
+}
+
+// Replaying reports whether the providers replay recorded responses instead of being called.
+func Replaying(cfg *config.Config) bool {
+	return cfg.CassetteMode == ModeReplay
+}
+
+func (t *transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	key, err := requestKey(request)
+	if err != nil {
+		return nil, err
+	}
+	filePath := filepath.Join(t.directory, key+fileExtension)
+
+	if t.mode == ModeReplay {
+		return replay(request, filePath)
+	}
+	response, err := t.base.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = &recorder{
+		body:     response.Body,
+		response: response,
+		filePath: filePath,
+	}
+	return response, nil
+}
+
+// requestKey returns the hash of the method, the path, the query and the body of a request, whose body is replaced by
+// a copy. The host and the headers are left out, so that a cassette replays against any base URL and without the API
+// keys.
+func requestKey(request *http.Request) (string, error) {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s %s?%s\n", request.Method, request.URL.Path, request.URL.RawQuery)
+	if request.Body != nil && request.Body != http.NoBody {
+		body, err := io.ReadAll(request.Body)
+		if err != nil {
+			return "", fmt.Errorf("error reading the request body (%w)", err)
+		}
+		if err := request.Body.Close(); err != nil {
+			return "", fmt.Errorf("error closing the request body (%w)", err)
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		hash.Write(body)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// replay returns the response recorded for a request.
+func replay(request *http.Request, filePath string) (*http.Response, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no cassette was recorded for %s %s (%s)", request.Method, request.URL.Path, filePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the cassette %s (%w)", filePath, err)
+	}
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), request)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the cassette %s (%w)", filePath, err)
+	}
+	return response, nil
+}
+
+// recorder keeps a copy of the body of a response while the provider reads it, and writes the response to a cassette
+// once the body was read to its end. A response that is not read to its end, such as a stream the client left, is not
+// recorded.
+type recorder struct {
+	body     io.ReadCloser
+	response *http.Response
+	filePath string
+
+	recorded bytes.Buffer
+	once     sync.Once
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.recorded.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		r.once.Do(r.write)
+	}
+	return n, err
+}
+
+func (r *recorder) Close() error {
+	return r.body.Close()
+}
+
+// write writes the response with the recorded body. The body is stored decoded, so its length replaces the transfer
+// encoding of the original response.
+func (r *recorder) write() {
+	header := r.response.Header.Clone()
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	recorded := &http.Response{
+		Status:        r.response.Status,
+		StatusCode:    r.response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.recorded.Bytes())),
+		ContentLength: int64(r.recorded.Len()),
+	}
+
+	cassette := bytes.Buffer{}
+	if err := recorded.Write(&cassette); err != nil {
+		logger.Errorf("Failed to encode the cassette %s (%s).", r.filePath, err.Error())
+		return
+	}
+	if err := os.WriteFile(r.filePath, cassette.Bytes(), 0o644); err != nil {
+		logger.Errorf("Failed to write the cassette %s (%s).", r.filePath, err.Error())
+	}
+}
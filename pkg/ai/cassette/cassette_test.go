@@ -0,0 +1,112 @@
+package cassette
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+)
+
+const streamBody = "data: {\"delta\":\"Hello\"}\n\ndata: {\"delta\":\" there\"}\n\ndata: [DONE]\n\n"
+
+func newServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Request-Id", "abc")
+		for _, event := range strings.SplitAfter(streamBody, "\n\n") {
+			_, _ = io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newClient(t *testing.T, mode string, directory string) *http.Client {
+	t.Helper()
+	roundTripper, err := NewTransport(&config.Config{CassetteMode: mode, CassetteDir: directory}, http.DefaultTransport)
+	if err != nil {
+		t.Fatalf("failed to create the transport (%s)", err)
+	}
+	return &http.Client{Transport: roundTripper}
+}
+
+func post(t *testing.T, client *http.Client, url string, body string) (*http.Response, string) {
+	t.Helper()
+	response, err := client.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to post (%s)", err)
+	}
+	defer func() { _ = response.Body.Close() }()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatalf("failed to read the body (%s)", err)
+	}
+	return response, string(data)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server, calls := newServer(t)
+	directory := t.TempDir()
+
+	_, recorded := post(t, newClient(t, ModeRecord, directory), server.URL+"/v1/chat", `{"q":"hi"}`)
+	if recorded != streamBody {
+		t.Fatalf("unexpected recorded body %q", recorded)
+	}
+
+	// The replay runs against another host, which must not matter.
+	response, replayed := post(t, newClient(t, ModeReplay, directory), "http://127.0.0.1:1/v1/chat", `{"q":"hi"}`)
+	if *calls != 1 {
+		t.Fatalf("expected the server to be called once, got %d calls", *calls)
+	}
+	if replayed != streamBody {
+		t.Fatalf("expected the replay to match the recording, got %q", replayed)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" || response.Header.Get("X-Request-Id") != "abc" {
+		t.Fatalf("unexpected replayed status %d and headers %v", response.StatusCode, response.Header)
+	}
+
+	_, err := newClient(t, ModeReplay, directory).Post(server.URL+"/v1/chat", "application/json", strings.NewReader(`{"q":"bye"}`))
+	if err == nil || !strings.Contains(err.Error(), "no cassette was recorded") {
+		t.Fatalf("expected a missing cassette error, got %v", err)
+	}
+}
+
+func TestPartialBodiesAreNotRecorded(t *testing.T) {
+	server, _ := newServer(t)
+	directory := t.TempDir()
+
+	response, err := newClient(t, ModeRecord, directory).Post(server.URL+"/v1/chat", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatalf("failed to post (%s)", err)
+	}
+	if _, err := response.Body.Read(make([]byte, 4)); err != nil {
+		t.Fatalf("failed to read the body (%s)", err)
+	}
+	_ = response.Body.Close()
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatalf("failed to list the cassettes (%s)", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expected no cassette, got %s", filepath.Join(directory, entries[0].Name()))
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	if roundTripper, err := NewTransport(&config.Config{}, http.DefaultTransport); err != nil || roundTripper != http.DefaultTransport {
+		t.Fatalf("expected the base transport without a mode, got %v and %v", roundTripper, err)
+	}
+	if _, err := NewTransport(&config.Config{CassetteMode: "rewind"}, http.DefaultTransport); err == nil {
+		t.Fatal("expected an unknown mode to fail")
+	}
+}
@@ -2,10 +2,68 @@ package ai
 
 import (
 	"context"
+	_ "embed"
 
 	"github.com/TriangleSide/CodebaseAI/pkg/models"
 )
 
+// Instructions is the default system prompt, for the chats without a project and the projects without their own.
+//
+//go:embed instructions.txt
+var Instructions string
+
+// PatchInstructions are added to the system prompt in patch mode.
+//
+//go:embed patch.txt
+var PatchInstructions string
+
+const (
+	PromptVariableProjectName = "projectName"
+	PromptVariableLanguages   = "languages"
+	PromptVariableDate        = "date"
+)
+
+// PromptVariables are the variables a system prompt can use.
+var PromptVariables = []string{PromptVariableProjectName, PromptVariableLanguages, PromptVariableDate}
+
 type Chat interface {
 	Stream(ctx context.Context, request *models.ChatRequest) (tokens <-chan *models.ChatResponse, err error)
 }
+
+// SystemPrompt returns the system prompt of the request, which is the resolved prompt of its project or the default
+// instructions.
+func SystemPrompt(request *models.ChatRequest) string {
+	if request.SystemPrompt != nil {
+		return *request.SystemPrompt
+	}
+	return Instructions
+}
+
+// Conversation returns the messages sent to the model. The codebase comes first, as a dedicated user message, when
+// the request has one.
+func Conversation(request *models.ChatRequest) []models.ChatMessage {
+	if request.Codebase == nil {
+		return request.Messages
+	}
+	messages := make([]models.ChatMessage, 0, len(request.Messages)+1)
+	messages = append(messages, CodebaseMessage(*request.Codebase))
+	return append(messages, request.Messages...)
+}
+
+// CodebaseMessage wraps the amalgam of a project in a user message.
+func CodebaseMessage(codebase string) models.ChatMessage {
+	return models.ChatMessage{
+		Role:    models.ChatRoleUser,
+		Content: "The codebase of the project is below.\n\n" + codebase + "// End of the codebase.",
+	}
+}
+
+// SendOverChannel sends a message unless the context is done first. It returns false if the message was not sent.
+func SendOverChannel(ctx context.Context, stream chan<- *models.ChatResponse, msg *models.ChatResponse) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case stream <- msg:
+		return true
+	}
+}
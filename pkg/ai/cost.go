@@ -0,0 +1,22 @@
+package ai
+
+import (
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	tokensPerPriceUnit = 1_000_000
+)
+
+// Cost returns the price in US dollars of the usage of a chat with a model. Cached prompt tokens are billed at the
+// input price when the model has no cached input price.
+func Cost(model *models.Model, usage *models.ChatUsage) float64 {
+	cachedPrice := model.CachedInputPrice
+	if cachedPrice == 0 {
+		cachedPrice = model.InputPrice
+	}
+	uncached := max(usage.PromptTokens-usage.CachedTokens, 0)
+	return (float64(uncached)*model.InputPrice +
+		float64(usage.CachedTokens)*cachedPrice +
+		float64(usage.CompletionTokens)*model.OutputPrice) / tokensPerPriceUnit
+}
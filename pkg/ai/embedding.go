@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Embedder turns texts into vectors, so that code can be retrieved by its similarity with a question.
+type Embedder interface {
+	// Name identifies the embedder and its model. Vectors of different embedders cannot be compared.
+	Name() string
+
+	// Embed returns a vector for every text, in the same order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var (
+	// wordPattern matches the identifiers and numbers of a text, without their underscores.
+	wordPattern = regexp.MustCompile(`[A-Za-z0-9]+`)
+)
+
+type hashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder returns a deterministic embedder that needs no network. Every word of a text, and every word of
+// its identifiers, is hashed into one of the dimensions of the vector. It only finds texts that share words, which is
+// enough for tests and for working offline.
+func NewHashEmbedder(dimensions int) Embedder {
+	return &hashEmbedder{
+		dimensions: dimensions,
+	}
+}
+
+func (h *hashEmbedder) Name() string {
+	return fmt.Sprintf("hash-%d", h.dimensions)
+}
+
+func (h *hashEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+	for _, text := range texts {
+		vector := make([]float32, h.dimensions)
+		for _, word := range wordPattern.FindAllString(text, -1) {
+			h.add(vector, strings.ToLower(word))
+			parts := SplitIdentifier(word)
+			if len(parts) > 1 {
+				for _, part := range parts {
+					h.add(vector, strings.ToLower(part))
+				}
+			}
+		}
+		normalize(vector)
+		vectors = append(vectors, vector)
+	}
+	return vectors, nil
+}
+
+// SplitIdentifier splits a camel case identifier such as parseHTTPRequest into its words: parse, HTTP and Request.
+func SplitIdentifier(identifier string) []string {
+	runes := []rune(identifier)
+	words := make([]string, 0, 1)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		lowerToUpper := !unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i])
+		acronymEnd := unicode.IsUpper(runes[i-1]) && unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+		if lowerToUpper || acronymEnd {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// add hashes a word into the vector. The sign comes from the hash too, so that collisions tend to cancel out.
+func (h *hashEmbedder) add(vector []float32, word string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(word))
+	sum := hash.Sum64()
+	if sum&(1<<63) != 0 {
+		vector[sum%uint64(h.dimensions)]--
+	} else {
+		vector[sum%uint64(h.dimensions)]++
+	}
+}
+
+func normalize(vector []float32) {
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+}
+
+// CosineSimilarity returns the cosine of the angle between two vectors, or zero if their lengths differ.
+func CosineSimilarity(a []float32, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+var (
+	// tokenPattern splits a reply into the tokens that are streamed, a word with the whitespace that follows it.
+	tokenPattern = regexp.MustCompile(`\s*\S+\s*`)
+)
+
+// Response is a scripted reply of the fake provider.
+type Response struct {
+	// Match is a regular expression on the latest question of the user. A response without it matches every question.
+	Match string `json:"match,omitempty"`
+
+	// Content is the reply, streamed word by word.
+	Content string `json:"content"`
+
+	// ConnectError fails the chat before it starts, like a provider that cannot be reached.
+	ConnectError string `json:"connectError,omitempty"`
+
+	// StreamError ends the stream with an error after ErrorAfterTokens tokens of the reply.
+	StreamError      string `json:"streamError,omitempty"`
+	ErrorAfterTokens int    `json:"errorAfterTokens,omitempty"`
+
+	// ToolCalls are the tools called on the first step of the agent mode, before the reply is given on the next step.
+	ToolCalls []*ToolCall `json:"toolCalls,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// ToolCall is a scripted call of a tool in agent mode. The arguments are a JSON object.
+type ToolCall struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// Script is the content of the script file of the fake provider.
+type Script struct {
+	Responses []*Response `json:"responses"`
+}
+
+type fakeChat struct {
+	model      string
+	tokenDelay time.Duration
+	responses  []*Response
+}
+
+// NewFakeChat creates a provider that replies without a network, for tests and offline development. The replies come
+// from the script file in order of their matches, and the provider echoes the question when no response matches.
+func NewFakeChat(cfg *config.Config) (ai.Chat, error) {
+	model := &fakeChat{
+		model:      cfg.ModelVersion,
+		tokenDelay: time.Duration(cfg.FakeTokenDelayMs) * time.Millisecond,
+		responses:  make([]*Response, 0),
+	}
+	if cfg.FakeScriptFile != "" {
+		script, err := loadScript(cfg.FakeScriptFile)
+		if err != nil {
+			return nil, err
+		}
+		model.responses = script.Responses
+	}
+	return model, nil
+}
+
+func loadScript(filePath string) (*Script, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the fake script file %s (%w)", filePath, err)
+	}
+	script := &Script{}
+	if err := json.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("error parsing the fake script file %s (%w)", filePath, err)
+	}
+	for i, response := range script.Responses {
+		if response.Match == "" {
+			continue
+		}
+		if response.pattern, err = regexp.Compile(response.Match); err != nil {
+			return nil, fmt.Errorf("invalid match of response %d in %s (%w)", i+1, filePath, err)
+		}
+	}
+	return script, nil
+}
+
+func (model *fakeChat) Stream(ctx context.Context, request *models.ChatRequest) (tokens <-chan *models.ChatResponse, err error) {
+	question := latestQuestion(request)
+	response := model.respond(question)
+	if response.ConnectError != "" {
+		return nil, errors.New(response.ConnectError)
+	}
+
+	modelName := model.modelName(request)
+	tokenStream := make(chan *models.ChatResponse)
+
+	go func() {
+		defer close(tokenStream)
+
+		reply := strings.Builder{}
+		for i, token := range tokenPattern.FindAllString(response.Content, -1) {
+			if response.StreamError != "" && i == response.ErrorAfterTokens {
+				break
+			}
+			if model.tokenDelay > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(model.tokenDelay):
+				}
+			}
+			reply.WriteString(token)
+			if !ai.SendOverChannel(ctx, tokenStream, &models.ChatResponse{Content: ptr.Of(token)}) {
+				return
+			}
+		}
+
+		msg := &models.ChatResponse{Done: ptr.Of(true)}
+		if response.StreamError != "" {
+			msg.Error = ptr.Of(response.StreamError)
+		} else {
+			msg.Usage = ai.EstimateUsage(modelName, request, reply.String())
+		}
+		_ = ai.SendOverChannel(ctx, tokenStream, msg)
+	}()
+
+	return tokenStream, nil
+}
+
+// Step replies to a step of the agent mode. The scripted tool calls of the response are made on the first step, unless
+// it is the final one, and the reply is given on the next. A stream error fails the step of the reply.
+func (model *fakeChat) Step(ctx context.Context, stream chan<- *models.ChatResponse, step *ai.AgentStep) (*ai.AgentTurn, error) {
+	response := model.respond(latestQuestion(step.Request))
+	if response.ConnectError != "" {
+		return nil, errors.New(response.ConnectError)
+	}
+	if model.tokenDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(model.tokenDelay):
+		}
+	}
+
+	turn := &ai.AgentTurn{}
+	switch {
+	case len(step.Turns) == 0 && !step.Final && len(response.ToolCalls) > 0:
+		for i, call := range response.ToolCalls {
+			arguments := string(call.Arguments)
+			if arguments == "" {
+				arguments = "{}"
+			}
+			turn.ToolCalls = append(turn.ToolCalls, &ai.ToolCall{
+				Id:        fmt.Sprintf("call_%d", i+1),
+				Name:      call.Name,
+				Arguments: arguments,
+			})
+		}
+	case response.StreamError != "":
+		return nil, errors.New(response.StreamError)
+	default:
+		turn.Content = response.Content
+	}
+	turn.Usage = ai.EstimateStepUsage(model.modelName(step.Request), step, turn.Content)
+	return turn, nil
+}
+
+// modelName returns the model selected by the request, or the configured model.
+func (model *fakeChat) modelName(request *models.ChatRequest) string {
+	if request.Model != nil {
+		return *request.Model
+	}
+	return model.model
+}
+
+// respond returns the first scripted response that matches the question, or an echo of the question.
+func (model *fakeChat) respond(question string) *Response {
+	for _, response := range model.responses {
+		if response.pattern == nil || response.pattern.MatchString(question) {
+			return response
+		}
+	}
+	return &Response{
+		Content: "This is a fake reply to: " + question,
+	}
+}
+
+// latestQuestion returns the content of the last user message of the request.
+func latestQuestion(request *models.ChatRequest) string {
+	for i := len(request.Messages) - 1; i >= 0; i-- {
+		if request.Messages[i].Role == models.ChatRoleUser {
+			return request.Messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package fake
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const script = `{"responses": [
+	{"match": "broken", "content": "Never sent.", "streamError": "connection reset"},
+	{"match": "main", "content": "main does nothing.", "toolCalls": [{"name": "read_file", "arguments": {"path": "main.go"}}, {"name": "list_files"}]}
+]}`
+
+func newToolChat(t *testing.T) ai.ToolChat {
+	t.Helper()
+	scriptFile := filepath.Join(t.TempDir(), "fake.json")
+	if err := os.WriteFile(scriptFile, []byte(script), 0o644); err != nil {
+		t.Fatalf("failed to write the script (%s)", err)
+	}
+	chat, err := NewFakeChat(&config.Config{ModelVersion: "fake", FakeScriptFile: scriptFile})
+	if err != nil {
+		t.Fatalf("failed to create the fake provider (%s)", err)
+	}
+	return chat.(ai.ToolChat)
+}
+
+func step(question string, turns []*ai.AgentTurn, final bool) *ai.AgentStep {
+	return &ai.AgentStep{
+		Request: &models.ChatRequest{Messages: []models.ChatMessage{{Role: models.ChatRoleUser, Content: question}}},
+		Turns:   turns,
+		Final:   final,
+	}
+}
+
+func TestStep(t *testing.T) {
+	chat := newToolChat(t)
+	stream := make(chan *models.ChatResponse, 10)
+
+	first, err := chat.Step(context.Background(), stream, step("What does main do?", nil, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if first.Content != "" || len(first.ToolCalls) != 2 || first.Usage == nil {
+		t.Fatalf("expected two tool calls with a usage, got %+v", first)
+	}
+	if call := first.ToolCalls[0]; call.Id != "call_1" || call.Name != "read_file" || call.Arguments != `{"path": "main.go"}` {
+		t.Fatalf("unexpected first call %+v", call)
+	}
+	if call := first.ToolCalls[1]; call.Id != "call_2" || call.Name != "list_files" || call.Arguments != "{}" {
+		t.Fatalf("unexpected second call %+v", call)
+	}
+
+	second, err := chat.Step(context.Background(), stream, step("What does main do?", []*ai.AgentTurn{first}, false))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if second.Content != "main does nothing." || len(second.ToolCalls) != 0 {
+		t.Fatalf("expected the reply, got %+v", second)
+	}
+
+	final, err := chat.Step(context.Background(), stream, step("What does main do?", nil, true))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if final.Content != "main does nothing." || len(final.ToolCalls) != 0 {
+		t.Fatalf("expected the final step to reply without tools, got %+v", final)
+	}
+
+	if _, err := chat.Step(context.Background(), stream, step("Is it broken?", nil, false)); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the stream error, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	ReasoningEffortLow    = "low"
+	ReasoningEffortMedium = "medium"
+	ReasoningEffortHigh   = "high"
+
+	maxTemperature   = 2.0
+	maxStopSequences = 4
+)
+
+// ValidationError is returned when the options of a request are invalid.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateGeneration checks the generation options against the limits shared by every provider. Providers reject the
+// values they do not support when the chat is streamed. The error is a *ValidationError.
+func ValidateGeneration(options *models.GenerationOptions) error {
+	if err := validateGeneration(options); err != nil {
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
+
+func validateGeneration(options *models.GenerationOptions) error {
+	if options == nil {
+		return nil
+	}
+	if options.Temperature != nil && (*options.Temperature < 0 || *options.Temperature > maxTemperature) {
+		return fmt.Errorf("the temperature must be between 0 and %g", maxTemperature)
+	}
+	if options.TopP != nil && (*options.TopP <= 0 || *options.TopP > 1) {
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	}
+	if options.MaxOutputTokens != nil && *options.MaxOutputTokens <= 0 {
+		return fmt.Errorf("the maximum amount of output tokens must be positive")
+	}
+	if len(options.Stop) > maxStopSequences {
+		return fmt.Errorf("at most %d stop sequences are allowed", maxStopSequences)
+	}
+	if slices.Contains(options.Stop, "") {
+		return fmt.Errorf("stop sequences cannot be empty")
+	}
+	if options.ReasoningEffort != nil {
+		switch *options.ReasoningEffort {
+		case ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh:
+		default:
+			return fmt.Errorf("the reasoning effort must be %s, %s or %s", ReasoningEffortLow, ReasoningEffortMedium, ReasoningEffortHigh)
+		}
+	}
+	return nil
+}
+
+// MergeGeneration returns the defaults with every option that is set in the overrides replaced. Either can be nil.
+func MergeGeneration(defaults *models.GenerationOptions, overrides *models.GenerationOptions) *models.GenerationOptions {
+	merged := &models.GenerationOptions{}
+	if defaults != nil {
+		*merged = *defaults
+	}
+	if overrides == nil {
+		return merged
+	}
+	if overrides.Temperature != nil {
+		merged.Temperature = overrides.Temperature
+	}
+	if overrides.TopP != nil {
+		merged.TopP = overrides.TopP
+	}
+	if overrides.MaxOutputTokens != nil {
+		merged.MaxOutputTokens = overrides.MaxOutputTokens
+	}
+	if overrides.Stop != nil {
+		merged.Stop = overrides.Stop
+	}
+	if overrides.Seed != nil {
+		merged.Seed = overrides.Seed
+	}
+	if overrides.ReasoningEffort != nil {
+		merged.ReasoningEffort = overrides.ReasoningEffort
+	}
+	return merged
+}
+
+// EmptyGeneration reports whether no generation option is set.
+func EmptyGeneration(options *models.GenerationOptions) bool {
+	return options == nil || (options.Temperature == nil && options.TopP == nil && options.MaxOutputTokens == nil &&
+		len(options.Stop) == 0 && options.Seed == nil && options.ReasoningEffort == nil)
+}
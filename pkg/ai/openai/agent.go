@@ -0,0 +1,96 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	// toolChoiceNone forbids tool calls on the final step of the agent.
+	toolChoiceNone = "none"
+)
+
+// Step sends the conversation, the previous tool calls and their results, and returns the next reply of the model.
+func (model *openaiChat) Step(ctx context.Context, stream chan<- *models.ChatResponse, step *ai.AgentStep) (*ai.AgentTurn, error) {
+	req := model.completionRequest(step.Request)
+	for _, turn := range step.Turns {
+		assistantMessage := openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: turn.Content,
+		}
+		for _, call := range turn.ToolCalls {
+			assistantMessage.ToolCalls = append(assistantMessage.ToolCalls, openai.ToolCall{
+				ID:   call.Id,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+		req.Messages = append(req.Messages, assistantMessage)
+		for _, result := range turn.Results {
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    result.Output,
+				ToolCallID: result.CallId,
+			})
+		}
+	}
+	for _, tool := range step.Tools {
+		req.Tools = append(req.Tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+	if step.Final {
+		req.ToolChoice = toolChoiceNone
+	}
+
+	response, err := ai.Connect(ctx, model.retryPolicy, stream, func() (openai.ChatCompletionResponse, error) {
+		holder := &retryAfter{}
+		response, err := model.client.CreateChatCompletion(requestContext(ctx, holder, step.Request.Generation), req)
+		if err != nil {
+			return response, connectError(err, holder)
+		}
+		return response, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calling OpenAI (%w)", err)
+	}
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("the OpenAI response has no choices")
+	}
+
+	message := response.Choices[0].Message
+	turn := &ai.AgentTurn{
+		Content: message.Content,
+	}
+	for _, call := range message.ToolCalls {
+		turn.ToolCalls = append(turn.ToolCalls, &ai.ToolCall{
+			Id:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	if response.Usage.TotalTokens > 0 {
+		turn.Usage = &models.ChatUsage{
+			PromptTokens:     response.Usage.PromptTokens,
+			CompletionTokens: response.Usage.CompletionTokens,
+		}
+		if response.Usage.PromptTokensDetails != nil {
+			turn.Usage.CachedTokens = response.Usage.PromptTokensDetails.CachedTokens
+		}
+	} else {
+		turn.Usage = ai.EstimateStepUsage(req.Model, step, message.Content)
+	}
+	return turn, nil
+}
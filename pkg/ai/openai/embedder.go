@@ -0,0 +1,53 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/sashabaranov/go-openai"
+)
+
+type openaiEmbedder struct {
+	client *openai.Client
+	model  string
+}
+
+// NewOpenAIEmbedder creates an embedder for the embeddings API of the configured OpenAI server.
+func NewOpenAIEmbedder(cfg *config.Config) (ai.Embedder, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &openaiEmbedder{
+		client: client,
+		model:  cfg.EmbeddingModel,
+	}, nil
+}
+
+func (e *openaiEmbedder) Name() string {
+	return config.ProviderOpenAI + "-" + e.model
+}
+
+func (e *openaiEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	response, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating OpenAI embeddings (%w)", err)
+	}
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI returned %d embeddings for %d texts", len(response.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, embedding := range response.Data {
+		if embedding.Index < 0 || embedding.Index >= len(texts) {
+			return nil, fmt.Errorf("OpenAI returned an embedding with the invalid index %d", embedding.Index)
+		}
+		vectors[embedding.Index] = embedding.Embedding
+	}
+	return vectors, nil
+}
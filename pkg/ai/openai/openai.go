@@ -2,11 +2,14 @@ package openai
 
 import (
 	"context"
-	_ "embed"
 	"fmt"
 	"io"
+	"net/http"
+	"strings"
+	"time"
 
 	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/cassette"
 	"github.com/TriangleSide/CodebaseAI/pkg/config"
 	"github.com/TriangleSide/CodebaseAI/pkg/models"
 	"github.com/TriangleSide/GoTools/pkg/logger"
@@ -14,41 +17,61 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
-//go:embed instructions.txt
-var instructions string
-
 type openaiChat struct {
 	client *openai.Client
 	model  string
+
+	// legacyMaxTokens sends the output limit as max_tokens, for servers compatible with the OpenAI API that do not
+	// understand max_completion_tokens.
+	legacyMaxTokens bool
+
+	retryPolicy *ai.RetryPolicy
 }
 
-func NewOpenAIChat(cfg *config.Config) ai.Chat {
-	client := openai.NewClient(cfg.ApiKey)
-	return &openaiChat{
-		client: client,
-		model:  cfg.ModelVersion,
+func NewOpenAIChat(cfg *config.Config) (ai.Chat, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
 	}
+	return &openaiChat{
+		client:          client,
+		model:           cfg.ModelVersion,
+		legacyMaxTokens: cfg.OpenaiLegacyMaxTokens,
+		retryPolicy:     ai.NewRetryPolicy(cfg),
+	}, nil
 }
 
-func (model *openaiChat) Stream(ctx context.Context, request *models.ChatRequest) (tokens <-chan *models.ChatResponse, err error) {
-	openaiMessages := make([]openai.ChatCompletionMessage, 0)
+// newClient creates a client for the configured server, with the configured headers and timeout.
+func newClient(cfg *config.Config) (*openai.Client, error) {
+	apiKey := cfg.ProviderApiKey(config.ProviderOpenAI)
+	headers, err := parseHeaders(cfg.OpenaiHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the OpenAI headers (%w)", err)
+	}
 
-	openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleSystem,
-		Content: instructions,
-	})
+	base, err := cassette.NewTransport(cfg, http.DefaultTransport)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, msg := range request.Messages {
-		openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
-			Role:    msg.Role,
-			Content: msg.Content,
-		})
+	clientConfig := openai.DefaultConfig(apiKey)
+	clientConfig.BaseURL = strings.TrimSuffix(cfg.OpenaiBaseUrl, "/")
+	clientConfig.HTTPClient = &http.Client{
+		Timeout: time.Duration(cfg.OpenaiTimeoutSeconds) * time.Second,
+		Transport: &headerTransport{
+			base:    base,
+			headers: headers,
+			noAuth:  apiKey == "",
+		},
 	}
+	return openai.NewClientWithConfig(clientConfig), nil
+}
 
-	req := openai.ChatCompletionRequest{
-		Model:    model.model,
-		Messages: openaiMessages,
-		Stream:   true,
+func (model *openaiChat) Stream(ctx context.Context, request *models.ChatRequest) (tokens <-chan *models.ChatResponse, err error) {
+	req := model.completionRequest(request)
+	req.Stream = true
+	req.StreamOptions = &openai.StreamOptions{
+		IncludeUsage: true,
 	}
 
 	tokenStream := make(chan *models.ChatResponse)
@@ -56,9 +79,16 @@ func (model *openaiChat) Stream(ctx context.Context, request *models.ChatRequest
 	go func() {
 		defer close(tokenStream)
 
-		openaiStream, err := model.client.CreateChatCompletionStream(ctx, req)
+		openaiStream, err := ai.Connect(ctx, model.retryPolicy, tokenStream, func() (*openai.ChatCompletionStream, error) {
+			holder := &retryAfter{}
+			openaiStream, err := model.client.CreateChatCompletionStream(requestContext(ctx, holder, request.Generation), req)
+			if err != nil {
+				return nil, connectError(err, holder)
+			}
+			return openaiStream, nil
+		})
 		if err != nil {
-			_ = sendOverChannel(ctx, tokenStream, &models.ChatResponse{Done: ptr.Of(true), Error: ptr.Of(fmt.Sprintf("Error connecting to OpenAI (%s).", err.Error()))})
+			_ = ai.SendOverChannel(ctx, tokenStream, &models.ChatResponse{Done: ptr.Of(true), Error: ptr.Of(fmt.Sprintf("Error connecting to OpenAI (%s).", err.Error()))})
 			return
 		}
 		defer func() {
@@ -67,19 +97,39 @@ func (model *openaiChat) Stream(ctx context.Context, request *models.ChatRequest
 			}
 		}()
 
+		reply := strings.Builder{}
+		var usage *models.ChatUsage
 		for {
 			response, err := openaiStream.Recv()
 			if err != nil {
 				msg := &models.ChatResponse{Done: ptr.Of(true)}
 				if err == io.EOF {
-					_ = sendOverChannel(ctx, tokenStream, msg)
+					if usage == nil {
+						usage = ai.EstimateUsage(req.Model, request, reply.String())
+					}
+					msg.Usage = usage
+					_ = ai.SendOverChannel(ctx, tokenStream, msg)
 				} else {
 					msg.Error = ptr.Of(err.Error())
-					_ = sendOverChannel(ctx, tokenStream, msg)
+					_ = ai.SendOverChannel(ctx, tokenStream, msg)
 				}
 				return
 			}
-			if !sendOverChannel(ctx, tokenStream, &models.ChatResponse{Content: ptr.Of(response.Choices[0].Delta.Content)}) {
+			if response.Usage != nil {
+				usage = &models.ChatUsage{
+					PromptTokens:     response.Usage.PromptTokens,
+					CompletionTokens: response.Usage.CompletionTokens,
+				}
+				if response.Usage.PromptTokensDetails != nil {
+					usage.CachedTokens = response.Usage.PromptTokensDetails.CachedTokens
+				}
+			}
+			// The usage is reported on a chunk without choices.
+			if len(response.Choices) == 0 {
+				continue
+			}
+			reply.WriteString(response.Choices[0].Delta.Content)
+			if !ai.SendOverChannel(ctx, tokenStream, &models.ChatResponse{Content: ptr.Of(response.Choices[0].Delta.Content)}) {
 				return
 			}
 		}
@@ -88,11 +138,60 @@ func (model *openaiChat) Stream(ctx context.Context, request *models.ChatRequest
 	return tokenStream, nil
 }
 
-func sendOverChannel(ctx context.Context, stream chan<- *models.ChatResponse, msg *models.ChatResponse) bool {
-	select {
-	case <-ctx.Done():
-		return false
-	case stream <- msg:
-		return true
+// completionRequest maps the chat request to a chat completion request, with the system prompt first.
+func (model *openaiChat) completionRequest(request *models.ChatRequest) openai.ChatCompletionRequest {
+	openaiMessages := make([]openai.ChatCompletionMessage, 0)
+
+	openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: ai.SystemPrompt(request),
+	})
+
+	for _, msg := range ai.Conversation(request) {
+		openaiMessages = append(openaiMessages, openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		})
+	}
+
+	req := openai.ChatCompletionRequest{
+		Model:    model.modelFor(request),
+		Messages: openaiMessages,
+	}
+	model.applyGeneration(&req, request.Generation)
+	return req
+}
+
+// modelFor returns the model selected by the request, or the configured model if there is none.
+func (model *openaiChat) modelFor(request *models.ChatRequest) string {
+	if request.Model != nil {
+		return *request.Model
+	}
+	return model.model
+}
+
+// applyGeneration maps the generation options to the request.
+func (model *openaiChat) applyGeneration(req *openai.ChatCompletionRequest, options *models.GenerationOptions) {
+	if options == nil {
+		return
+	}
+	// A temperature or a top_p of zero is dropped from the body by the client, the transport writes it back.
+	if options.Temperature != nil {
+		req.Temperature = float32(*options.Temperature)
+	}
+	if options.TopP != nil {
+		req.TopP = float32(*options.TopP)
+	}
+	if options.MaxOutputTokens != nil {
+		if model.legacyMaxTokens {
+			req.MaxTokens = *options.MaxOutputTokens
+		} else {
+			req.MaxCompletionTokens = *options.MaxOutputTokens
+		}
+	}
+	req.Stop = options.Stop
+	req.Seed = options.Seed
+	if options.ReasoningEffort != nil {
+		req.ReasoningEffort = *options.ReasoningEffort
 	}
 }
@@ -0,0 +1,313 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	testModel = "llama-test"
+)
+
+func completionChunks(contents ...string) string {
+	sb := strings.Builder{}
+	for _, content := range contents {
+		sb.WriteString(fmt.Sprintf("data: {\"id\":\"chunk\",\"object\":\"chat.completion.chunk\",\"model\":%q,\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", testModel, content))
+	}
+	sb.WriteString("data: {\"id\":\"chunk\",\"object\":\"chat.completion.chunk\",\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":3,\"total_tokens\":15}}\n\n")
+	sb.WriteString("data: [DONE]\n\n")
+	return sb.String()
+}
+
+func newTestChat(t *testing.T, cfg *config.Config, handler http.HandlerFunc) ai.Chat {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.Provider = config.ProviderOpenAI
+	cfg.ModelVersion = testModel
+	cfg.OpenaiBaseUrl = server.URL + "/v1/"
+	cfg.RetryMaxAttempts = 1
+	chat, err := NewOpenAIChat(cfg)
+	if err != nil {
+		t.Fatalf("failed to create the chat (%s)", err)
+	}
+	return chat
+}
+
+func collect(t *testing.T, tokens <-chan *models.ChatResponse) (string, *models.ChatResponse) {
+	t.Helper()
+	text := strings.Builder{}
+	for token := range tokens {
+		if token.Content != nil {
+			text.WriteString(*token.Content)
+		}
+		if token.Done != nil && *token.Done {
+			return text.String(), token
+		}
+	}
+	t.Fatal("the stream ended without a done message")
+	return "", nil
+}
+
+func chatRequest() *models.ChatRequest {
+	return &models.ChatRequest{
+		Messages: []models.ChatMessage{{Role: models.ChatRoleUser, Content: "Say hello."}},
+	}
+}
+
+func TestStreamFromCompatibleServer(t *testing.T) {
+	testCases := []struct {
+		name          string
+		apiKey        string
+		authorization string
+	}{
+		{
+			name:          "without an API key",
+			authorization: "",
+		},
+		{
+			name:          "with an API key",
+			apiKey:        "test-key",
+			authorization: "Bearer test-key",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := &config.Config{
+				OpenaiApiKey:         testCase.apiKey,
+				OpenaiHeaders:        "X-Team=platform, X-Trace = abc",
+				OpenaiTimeoutSeconds: 10,
+			}
+			chat := newTestChat(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/v1/chat/completions" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				if r.Header.Get("X-Team") != "platform" || r.Header.Get("X-Trace") != "abc" {
+					t.Errorf("the custom headers are missing from %v", r.Header)
+				}
+				if authorization := r.Header.Get("Authorization"); authorization != testCase.authorization {
+					t.Errorf("expected the authorization %q, got %q", testCase.authorization, authorization)
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				_, _ = w.Write([]byte(completionChunks("Hello", " world")))
+			})
+
+			tokens, err := chat.Stream(context.Background(), chatRequest())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			text, done := collect(t, tokens)
+			if done.Error != nil {
+				t.Fatalf("unexpected error: %s", *done.Error)
+			}
+			if text != "Hello world" {
+				t.Fatalf("expected %q, got %q", "Hello world", text)
+			}
+			expectedUsage := models.ChatUsage{PromptTokens: 12, CompletionTokens: 3}
+			if done.Usage == nil || *done.Usage != expectedUsage {
+				t.Fatalf("expected usage %+v, got %+v", expectedUsage, done.Usage)
+			}
+		})
+	}
+}
+
+func TestStreamTimeout(t *testing.T) {
+	cfg := &config.Config{
+		OpenaiTimeoutSeconds: 1,
+	}
+	release := make(chan struct{})
+	chat := newTestChat(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	t.Cleanup(func() { close(release) })
+
+	start := time.Now()
+	tokens, err := chat.Stream(context.Background(), chatRequest())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, done := collect(t, tokens)
+	if done.Error == nil || !strings.Contains(*done.Error, "Timeout") {
+		t.Fatalf("expected a timeout error, got %v", done.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("the request was not cut after the timeout, it took %s", elapsed)
+	}
+}
+
+func TestStreamGenerationOptions(t *testing.T) {
+	testCases := []struct {
+		name            string
+		legacyMaxTokens bool
+		generation      *models.GenerationOptions
+		expected        map[string]string
+		absent          []string
+	}{
+		{
+			name:       "zero temperature and top_p",
+			generation: &models.GenerationOptions{Temperature: ptr.Of(0.0), TopP: ptr.Of(0.0)},
+			expected:   map[string]string{"temperature": "0", "top_p": "0"},
+		},
+		{
+			name:       "unset temperature",
+			generation: &models.GenerationOptions{Seed: ptr.Of(7)},
+			expected:   map[string]string{"seed": "7"},
+			absent:     []string{"temperature", "top_p"},
+		},
+		{
+			name:       "max completion tokens",
+			generation: &models.GenerationOptions{MaxOutputTokens: ptr.Of(100)},
+			expected:   map[string]string{"max_completion_tokens": "100"},
+			absent:     []string{"max_tokens"},
+		},
+		{
+			name:            "legacy max tokens",
+			legacyMaxTokens: true,
+			generation:      &models.GenerationOptions{MaxOutputTokens: ptr.Of(100)},
+			expected:        map[string]string{"max_tokens": "100"},
+			absent:          []string{"max_completion_tokens"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			cfg := &config.Config{
+				OpenaiLegacyMaxTokens: testCase.legacyMaxTokens,
+			}
+			chat := newTestChat(t, cfg, func(w http.ResponseWriter, r *http.Request) {
+				body := make(map[string]json.RawMessage)
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Errorf("failed to decode the request body (%s)", err)
+				}
+				for field, value := range testCase.expected {
+					if string(body[field]) != value {
+						t.Errorf("expected %s to be %s, got %s", field, value, body[field])
+					}
+				}
+				for _, field := range testCase.absent {
+					if _, ok := body[field]; ok {
+						t.Errorf("expected no %s, got %s", field, body[field])
+					}
+				}
+				_, _ = w.Write([]byte(completionChunks("Hello")))
+			})
+
+			request := chatRequest()
+			request.Generation = testCase.generation
+			tokens, err := chat.Stream(context.Background(), request)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if _, done := collect(t, tokens); done.Error != nil {
+				t.Fatalf("unexpected error: %s", *done.Error)
+			}
+		})
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := parseHeaders(" X-Team=platform,,X-Empty=")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if headers.Get("X-Team") != "platform" || len(headers.Values("X-Empty")) != 1 {
+		t.Fatalf("unexpected headers %v", headers)
+	}
+
+	if _, err := parseHeaders("X-Team"); err == nil {
+		t.Fatal("expected an error for a header without a value")
+	}
+}
+
+func TestStreamRetries(t *testing.T) {
+	testCases := []struct {
+		name      string
+		status    int
+		requests  int32
+		statuses  []*models.ChatStatus
+		errorText string
+	}{
+		{
+			name:     "rate limit with Retry-After",
+			status:   http.StatusTooManyRequests,
+			requests: 2,
+			statuses: []*models.ChatStatus{{Type: ai.ChatStatusRetrying, Attempt: 2, MaxAttempts: 3, DelayMs: 50}},
+		},
+		{
+			name:      "client error",
+			status:    http.StatusBadRequest,
+			requests:  1,
+			errorText: "400",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			requests := &atomic.Int32{}
+			chat := newTestChat(t, &config.Config{}, func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Retry-After", "1")
+					w.WriteHeader(testCase.status)
+					_, _ = w.Write([]byte(`{"error":{"message":"try again later","type":"rate_limit"}}`))
+					return
+				}
+				_, _ = w.Write([]byte(completionChunks("Hello")))
+			})
+			// Without a base delay the backoff is zero, so a delay can only come from the Retry-After header, cut to
+			// the maximum delay.
+			chat.(*openaiChat).retryPolicy = &ai.RetryPolicy{MaxAttempts: 3, MaxDelay: 50 * time.Millisecond}
+
+			tokens, err := chat.Stream(context.Background(), chatRequest())
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			statuses := make([]*models.ChatStatus, 0)
+			var done *models.ChatResponse
+			for token := range tokens {
+				if token.Status != nil {
+					token.Status.Message = ""
+					statuses = append(statuses, token.Status)
+				}
+				if token.Done != nil {
+					done = token
+				}
+			}
+
+			if requests.Load() != testCase.requests {
+				t.Fatalf("expected %d requests, got %d", testCase.requests, requests.Load())
+			}
+			if len(statuses) != len(testCase.statuses) {
+				t.Fatalf("expected %d status messages, got %d", len(testCase.statuses), len(statuses))
+			}
+			for i, status := range statuses {
+				if *status != *testCase.statuses[i] {
+					t.Fatalf("expected the status %+v, got %+v", testCase.statuses[i], status)
+				}
+			}
+			if done == nil {
+				t.Fatal("the stream ended without a done message")
+			}
+			if testCase.errorText == "" && done.Error != nil {
+				t.Fatalf("unexpected error: %s", *done.Error)
+			}
+			if testCase.errorText != "" && (done.Error == nil || !strings.Contains(*done.Error, testCase.errorText)) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.errorText, done.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/sashabaranov/go-openai"
+)
+
+// headerTransport adds the configured headers to every request. The authorization header is removed when there is
+// no API key, since local servers can reject an empty bearer token.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+	noAuth  bool
+}
+
+func (t *headerTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	if t.noAuth {
+		request.Header.Del("Authorization")
+	}
+	for name, values := range t.headers {
+		request.Header[name] = values
+	}
+	if fields, ok := request.Context().Value(zeroFieldsKey{}).([]string); ok {
+		if err := setZeroFields(request, fields); err != nil {
+			return nil, err
+		}
+	}
+	response, err := t.base.RoundTrip(request)
+	if err == nil {
+		if holder, ok := request.Context().Value(retryAfterKey{}).(*retryAfter); ok {
+			holder.value = ai.ParseRetryAfter(response.Header.Get("Retry-After"))
+		}
+	}
+	return response, err
+}
+
+// retryAfterKey stores a *retryAfter in the context of a request, since the errors of the client do not carry the
+// headers of the response.
+type retryAfterKey struct{}
+
+type retryAfter struct {
+	value time.Duration
+}
+
+// zeroFieldsKey stores in the context of a request the fields of the body that must be sent with a zero value. The
+// client drops zero values from the body with omitempty, although a temperature or a top_p of zero is meaningful.
+type zeroFieldsKey struct{}
+
+// zeroFields returns the fields of the generation options that are explicitly set to zero.
+func zeroFields(options *models.GenerationOptions) []string {
+	if options == nil {
+		return nil
+	}
+	fields := make([]string, 0)
+	if options.Temperature != nil && *options.Temperature == 0 {
+		fields = append(fields, "temperature")
+	}
+	if options.TopP != nil && *options.TopP == 0 {
+		fields = append(fields, "top_p")
+	}
+	return fields
+}
+
+// requestContext returns the context of a call to the client, with the holder of the Retry-After header and the
+// fields of the generation options that are explicitly set to zero.
+func requestContext(ctx context.Context, holder *retryAfter, options *models.GenerationOptions) context.Context {
+	ctx = context.WithValue(ctx, retryAfterKey{}, holder)
+	if fields := zeroFields(options); len(fields) > 0 {
+		ctx = context.WithValue(ctx, zeroFieldsKey{}, fields)
+	}
+	return ctx
+}
+
+// setZeroFields writes the fields back to the JSON body of a request with a zero value.
+func setZeroFields(request *http.Request, fields []string) error {
+	if request.Body == nil {
+		return nil
+	}
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return fmt.Errorf("error reading the request body (%w)", err)
+	}
+	if err := request.Body.Close(); err != nil {
+		return fmt.Errorf("error closing the request body (%w)", err)
+	}
+
+	object := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &object); err != nil {
+		return fmt.Errorf("error decoding the request body (%w)", err)
+	}
+	for _, field := range fields {
+		object[field] = json.RawMessage("0")
+	}
+	if body, err = json.Marshal(object); err != nil {
+		return fmt.Errorf("error encoding the request body (%w)", err)
+	}
+
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	request.ContentLength = int64(len(body))
+	return nil
+}
+
+// connectError converts an error of the client to an ai.StatusError when it has a status code.
+func connectError(err error, holder *retryAfter) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode != 0 {
+		return &ai.StatusError{StatusCode: apiErr.HTTPStatusCode, RetryAfter: holder.value, Err: err}
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) && requestErr.HTTPStatusCode != 0 {
+		return &ai.StatusError{StatusCode: requestErr.HTTPStatusCode, RetryAfter: holder.value, Err: err}
+	}
+	return err
+}
+
+// parseHeaders parses comma separated Name=Value pairs.
+func parseHeaders(value string) (http.Header, error) {
+	headers := http.Header{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, headerValue, found := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid header '%s', expected Name=Value", strings.TrimSpace(pair))
+		}
+		headers.Add(name, strings.TrimSpace(headerValue))
+	}
+	return headers, nil
+}
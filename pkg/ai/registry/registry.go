@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/anthropic"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/cassette"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/fake"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/openai"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+// Registry holds the configured providers and the models that can be selected on a chat request. It implements
+// ai.Chat by routing every request to the provider of the selected model.
+type Registry struct {
+	providers       map[string]ai.Chat
+	models          []*models.Model
+	defaultProvider string
+	agentMaxSteps   int
+
+	// replaying is set when the providers replay recorded responses, which cost nothing.
+	replaying bool
+}
+
+// SelectionError is returned when a request selects a provider or a model that is not available.
+type SelectionError struct {
+	Err error
+}
+
+func (e *SelectionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SelectionError) Unwrap() error {
+	return e.Err
+}
+
+// New creates the default provider and every other provider with an API key, and loads the models of these
+// providers from the models file. The configured model is always available on the default provider.
+func New(cfg *config.Config) (*Registry, error) {
+	r := &Registry{
+		providers:       make(map[string]ai.Chat),
+		models:          make([]*models.Model, 0),
+		defaultProvider: cfg.Provider,
+		agentMaxSteps:   cfg.AgentMaxSteps,
+		replaying:       cassette.Replaying(cfg),
+	}
+
+	constructors := map[string]func(*config.Config) (ai.Chat, error){
+		config.ProviderOpenAI:    openai.NewOpenAIChat,
+		config.ProviderAnthropic: anthropic.NewAnthropicChat,
+		config.ProviderFake:      fake.NewFakeChat,
+	}
+	for provider, constructor := range constructors {
+		if provider != cfg.Provider && cfg.ProviderApiKey(provider) == "" {
+			continue
+		}
+		chat, err := constructor(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the %s provider (%w)", provider, err)
+		}
+		r.providers[provider] = chat
+	}
+
+	configuredModels, err := loadModels(cfg.ModelsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.models = append(r.models, &models.Model{
+		Provider: cfg.Provider,
+		Name:     cfg.ModelVersion,
+		Default:  true,
+	})
+	for _, model := range configuredModels {
+		if _, ok := r.providers[model.Provider]; !ok {
+			continue
+		}
+		if model.Provider == cfg.Provider && model.Name == cfg.ModelVersion {
+			*r.models[0] = *model
+			r.models[0].Default = true
+			continue
+		}
+		r.models = append(r.models, model)
+	}
+
+	return r, nil
+}
+
+func loadModels(filePath string) ([]*models.Model, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the models file %s (%w)", filePath, err)
+	}
+
+	type ModelsConfig struct {
+		Models []*models.Model `json:"models"`
+	}
+	var modelsConfig ModelsConfig
+	if err := json.Unmarshal(data, &modelsConfig); err != nil {
+		return nil, fmt.Errorf("error parsing the models file %s (%w)", filePath, err)
+	}
+
+	for _, model := range modelsConfig.Models {
+		if model.Provider == "" || model.Name == "" {
+			return nil, fmt.Errorf("a model in %s is missing its provider or name", filePath)
+		}
+		model.Default = false
+	}
+	return modelsConfig.Models, nil
+}
+
+// Models returns the models that can be selected, starting with the default model.
+func (r *Registry) Models() []*models.Model {
+	return r.models
+}
+
+// Replaying reports whether the providers replay recorded responses instead of being called.
+func (r *Registry) Replaying() bool {
+	return r.replaying
+}
+
+// Lookup returns the model selected by a provider and a model name, which are both optional. Without a model the
+// first model of the provider is used, and without a provider the provider of the model is used. The error is a
+// *SelectionError.
+func (r *Registry) Lookup(provider *string, model *string) (*models.Model, error) {
+	if provider != nil {
+		if _, ok := r.providers[*provider]; !ok {
+			return nil, &SelectionError{Err: fmt.Errorf("the provider '%s' is not configured", *provider)}
+		}
+	}
+
+	for _, candidate := range r.models {
+		if provider != nil && candidate.Provider != *provider {
+			continue
+		}
+		if model != nil && candidate.Name != *model {
+			continue
+		}
+		if provider == nil && model == nil && !candidate.Default {
+			continue
+		}
+		return candidate, nil
+	}
+
+	if provider != nil && model != nil {
+		return nil, &SelectionError{Err: fmt.Errorf("the model '%s' is not available from the provider '%s'", *model, *provider)}
+	}
+	if model != nil {
+		return nil, &SelectionError{Err: fmt.Errorf("the model '%s' is not available", *model)}
+	}
+	return nil, &SelectionError{Err: fmt.Errorf("the provider '%s' has no models", *provider)}
+}
+
+// Stream validates the provider and the model of the request and streams the reply of the selected model. The oldest
+// turns are dropped when the conversation does not fit in the context window of the model.
+func (r *Registry) Stream(ctx context.Context, request *models.ChatRequest) (<-chan *models.ChatResponse, error) {
+	model, routed, trimmed, err := r.route(request)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("Streaming the chat with the model '%s' of the provider '%s'.", model.Name, model.Provider)
+
+	tokens, err := r.providers[model.Provider].Stream(ctx, routed)
+	if err != nil || trimmed == nil {
+		return tokens, err
+	}
+	return ai.WithTrimmed(ctx, tokens, trimmed), nil
+}
+
+// Agent runs the chat in agent mode with the selected model, which reads the project with the tools of the executor.
+func (r *Registry) Agent(ctx context.Context, request *models.ChatRequest, executor ai.ToolExecutor) (<-chan *models.ChatResponse, error) {
+	model, routed, trimmed, err := r.route(request)
+	if err != nil {
+		return nil, err
+	}
+	toolChat, ok := r.providers[model.Provider].(ai.ToolChat)
+	if !ok {
+		return nil, &SelectionError{Err: fmt.Errorf("the provider '%s' does not support agent mode", model.Provider)}
+	}
+	logger.Debugf("Running the agent with the model '%s' of the provider '%s'.", model.Name, model.Provider)
+
+	tokens := ai.RunAgent(ctx, toolChat, routed, executor, r.agentMaxSteps, model.ContextWindow)
+	if trimmed == nil {
+		return tokens, nil
+	}
+	return ai.WithTrimmed(ctx, tokens, trimmed), nil
+}
+
+// route selects the model of the request and returns a copy of the request for it. Without a known context window
+// the conversation is sent as is, otherwise the oldest turns that do not fit are dropped.
+func (r *Registry) route(request *models.ChatRequest) (*models.Model, *models.ChatRequest, *models.ChatTrimmed, error) {
+	model, err := r.Lookup(request.Provider, request.Model)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	routed := *request
+	routed.Provider = ptr.Of(model.Provider)
+	routed.Model = ptr.Of(model.Name)
+
+	var trimmed *models.ChatTrimmed
+	if model.ContextWindow > 0 {
+		if trimmed, err = ai.Trim(&routed, model.Name, model.ContextWindow); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if trimmed != nil {
+		logger.Infof("Trimmed %d messages (%d tokens) from the chat to fit the context window of %s.", trimmed.Messages, trimmed.Tokens, model.Name)
+	}
+	return model, &routed, trimmed, nil
+}
@@ -0,0 +1,136 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	ChatStatusRetrying = "retrying"
+)
+
+// RetryPolicy decides how often and how long to wait before connecting to a provider again.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func NewRetryPolicy(cfg *config.Config) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: max(cfg.RetryMaxAttempts, 1),
+		BaseDelay:   time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond,
+		MaxDelay:    time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond,
+	}
+}
+
+// StatusError is an error response of a provider.
+type StatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRetryAfter reads a Retry-After header, which holds either seconds or a date. It returns zero if the header is
+// missing or invalid.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// transient reports whether an error is worth retrying: rate limits, server errors and network failures.
+func transient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// delay returns the wait before an attempt. The server's Retry-After wins over the jittered exponential backoff.
+// Connect caps it at the maximum delay.
+func (p *RetryPolicy) delay(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return statusErr.RetryAfter
+	}
+	backoff := min(p.BaseDelay<<(attempt-1), p.MaxDelay)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// exhausted describes the error of the last attempt. A rate limit says when the provider allows the next request.
+func exhausted(attempts int, err error) error {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests {
+		return err
+	}
+	if statusErr.RetryAfter > 0 {
+		return fmt.Errorf("rate limited by the provider after %d attempts, it asked to retry in %s (%w)", attempts, statusErr.RetryAfter.Round(time.Second), err)
+	}
+	return fmt.Errorf("rate limited by the provider after %d attempts (%w)", attempts, err)
+}
+
+// Connect calls connect until it succeeds, fails with an error that is not transient, or runs out of attempts. Every
+// retry is announced on the stream with a status message, so it must be called before the first token is sent.
+func Connect[T any](ctx context.Context, policy *RetryPolicy, stream chan<- *models.ChatResponse, connect func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		result, err := connect()
+		if err == nil || !transient(err) {
+			return result, err
+		}
+		if attempt >= policy.MaxAttempts {
+			return result, exhausted(attempt, err)
+		}
+
+		// A Retry-After longer than the maximum delay is cut to it, the next attempt may still be rate limited.
+		wait := min(policy.delay(attempt, err), policy.MaxDelay)
+		logger.Warnf("Attempt %d of %d to reach the provider failed, retrying in %s (%s).", attempt, policy.MaxAttempts, wait, err.Error())
+
+		status := &models.ChatStatus{
+			Type:        ChatStatusRetrying,
+			Attempt:     attempt + 1,
+			MaxAttempts: policy.MaxAttempts,
+			DelayMs:     int(wait.Milliseconds()),
+			Message:     err.Error(),
+		}
+		if !SendOverChannel(ctx, stream, &models.ChatResponse{Status: status}) {
+			return result, ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+// failingServer answers the first failures requests with the status and headers, and the following ones with 200.
+func failingServer(t *testing.T, failures int32, status int, headers map[string]string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures {
+			for name, value := range headers {
+				w.Header().Set(name, value)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+// get calls the server and converts the responses other than 200 to a StatusError, like the providers do.
+func get(url string) func() (*http.Response, error) {
+	return func() (*http.Response, error) {
+		response, err := http.Get(url)
+		if err != nil {
+			return nil, err
+		}
+		if response.StatusCode == http.StatusOK {
+			return response, nil
+		}
+		_ = response.Body.Close()
+		return nil, &StatusError{
+			StatusCode: response.StatusCode,
+			RetryAfter: ParseRetryAfter(response.Header.Get("Retry-After")),
+			Err:        fmt.Errorf("status %d", response.StatusCode),
+		}
+	}
+}
+
+func TestConnect(t *testing.T) {
+	testCases := []struct {
+		name        string
+		failures    int32
+		status      int
+		headers     map[string]string
+		maxAttempts int
+		requests    int32
+		delaysMs    []int
+		errorText   string
+	}{
+		{
+			name:        "rate limit with Retry-After",
+			failures:    1,
+			status:      http.StatusTooManyRequests,
+			headers:     map[string]string{"Retry-After": "1"},
+			maxAttempts: 3,
+			requests:    2,
+			delaysMs:    []int{50},
+		},
+		{
+			name:        "server error",
+			failures:    2,
+			status:      http.StatusBadGateway,
+			maxAttempts: 3,
+			requests:    3,
+			delaysMs:    []int{-1, -1},
+		},
+		{
+			name:        "client error",
+			failures:    1,
+			status:      http.StatusBadRequest,
+			maxAttempts: 3,
+			requests:    1,
+			errorText:   "status 400",
+		},
+		{
+			name:        "rate limit on every attempt",
+			failures:    5,
+			status:      http.StatusTooManyRequests,
+			headers:     map[string]string{"Retry-After": "120"},
+			maxAttempts: 2,
+			requests:    2,
+			delaysMs:    []int{50},
+			errorText:   "rate limited by the provider after 2 attempts, it asked to retry in 2m0s (status 429)",
+		},
+		{
+			name:        "server error on every attempt",
+			failures:    5,
+			status:      http.StatusServiceUnavailable,
+			maxAttempts: 2,
+			requests:    2,
+			delaysMs:    []int{-1},
+			errorText:   "status 503",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server, requests := failingServer(t, testCase.failures, testCase.status, testCase.headers)
+			policy := &RetryPolicy{
+				MaxAttempts: testCase.maxAttempts,
+				BaseDelay:   10 * time.Millisecond,
+				MaxDelay:    50 * time.Millisecond,
+			}
+			stream := make(chan *models.ChatResponse, 10)
+
+			response, err := Connect(context.Background(), policy, stream, get(server.URL))
+			close(stream)
+			if testCase.errorText == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				_ = response.Body.Close()
+			} else if err == nil || err.Error() != testCase.errorText {
+				t.Fatalf("expected the error %q, got %v", testCase.errorText, err)
+			}
+			if requests.Load() != testCase.requests {
+				t.Fatalf("expected %d requests, got %d", testCase.requests, requests.Load())
+			}
+
+			statuses := make([]*models.ChatStatus, 0)
+			for message := range stream {
+				statuses = append(statuses, message.Status)
+			}
+			if len(statuses) != len(testCase.delaysMs) {
+				t.Fatalf("expected %d retry statuses, got %d", len(testCase.delaysMs), len(statuses))
+			}
+			for i, status := range statuses {
+				if status.Type != ChatStatusRetrying || status.Attempt != i+2 || status.MaxAttempts != testCase.maxAttempts {
+					t.Fatalf("unexpected status %+v", status)
+				}
+				if testCase.delaysMs[i] >= 0 && status.DelayMs != testCase.delaysMs[i] {
+					t.Fatalf("expected a delay of %dms, got %dms", testCase.delaysMs[i], status.DelayMs)
+				}
+				if status.DelayMs > int(policy.MaxDelay.Milliseconds()) {
+					t.Fatalf("the delay %dms is longer than the maximum delay", status.DelayMs)
+				}
+			}
+		})
+	}
+}
+
+func TestConnectStopsWhenTheContextIsDone(t *testing.T) {
+	server, requests := failingServer(t, 5, http.StatusInternalServerError, nil)
+	policy := &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Hour,
+		MaxDelay:    time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := make(chan *models.ChatResponse, 10)
+
+	go func() {
+		<-stream
+		cancel()
+	}()
+	_, err := Connect(ctx, policy, stream, get(server.URL))
+	if err != context.Canceled {
+		t.Fatalf("expected the context to be canceled, got %v", err)
+	}
+	if requests.Load() != 1 {
+		t.Fatalf("expected a single request, got %d", requests.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+		within   time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "3", expected: 3 * time.Second},
+		{value: "0", expected: 0},
+		{value: "-2", expected: 0},
+		{value: "soon", expected: 0},
+		{value: time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat), expected: 30 * time.Second, within: 2 * time.Second},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), expected: 0},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(strings.ReplaceAll(testCase.value, " ", "_"), func(t *testing.T) {
+			actual := ParseRetryAfter(testCase.value)
+			if actual < testCase.expected-testCase.within || actual > testCase.expected+testCase.within {
+				t.Fatalf("expected %s, got %s", testCase.expected, actual)
+			}
+		})
+	}
+}
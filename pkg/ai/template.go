@@ -0,0 +1,54 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// templateVariablePattern matches a variable of a template, such as {{projectName}}.
+	templateVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_]*)\s*\}\}`)
+)
+
+// TemplateVariables returns the names of the variables of a template, in the order they first appear.
+func TemplateVariables(template string) []string {
+	variables := make([]string, 0)
+	for _, match := range templateVariablePattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(variables, match[1]) {
+			variables = append(variables, match[1])
+		}
+	}
+	return variables
+}
+
+// ValidateTemplate checks that a template only uses the allowed variables. The error is a *ValidationError.
+func ValidateTemplate(template string, allowed []string) error {
+	for _, variable := range TemplateVariables(template) {
+		if !slices.Contains(allowed, variable) {
+			return &ValidationError{Err: fmt.Errorf("unknown variable {{%s}}, the variables are %s", variable, strings.Join(allowed, ", "))}
+		}
+	}
+	return nil
+}
+
+// RenderTemplate replaces the variables of a template with their values. Every variable must have a value.
+func RenderTemplate(template string, values map[string]string) (string, error) {
+	var missing []string
+	rendered := templateVariablePattern.ReplaceAllStringFunc(template, func(match string) string {
+		name := templateVariablePattern.FindStringSubmatch(match)[1]
+		value, ok := values[name]
+		if !ok {
+			if !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("no value for the variables %s", strings.Join(missing, ", "))
+	}
+	return rendered, nil
+}
@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"sync"
+
+	"github.com/tiktoken-go/tokenizer"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// messageOverheadTokens is the amount of tokens added to every message by the chat formats of the providers.
+	messageOverheadTokens = 4
+)
+
+var (
+	codecs sync.Map
+)
+
+// codecFor returns the tokenizer of a model. Models that the tokenizer does not know, such as the models of other
+// providers, are estimated with cl100k_base.
+func codecFor(model string) tokenizer.Codec {
+	if codec, ok := codecs.Load(model); ok {
+		return codec.(tokenizer.Codec)
+	}
+	codec, err := forModel(model)
+	if err != nil {
+		if codec, err = tokenizer.Get(tokenizer.Cl100kBase); err != nil {
+			return nil
+		}
+	}
+	codecs.Store(model, codec)
+	return codec
+}
+
+// forModel returns the tokenizer of a model known to the tokenizer library. The library panics on the names that are
+// shorter than some of its model prefixes, those models are treated as unknown.
+func forModel(model string) (codec tokenizer.Codec, err error) {
+	defer func() {
+		if recover() != nil {
+			codec, err = nil, tokenizer.ErrModelNotSupported
+		}
+	}()
+	return tokenizer.ForModel(tokenizer.Model(model))
+}
+
+// CountTokens returns the amount of tokens of a text for a model. The length of the text divided by four is used when
+// the text cannot be tokenized.
+func CountTokens(model string, text string) int {
+	if codec := codecFor(model); codec != nil {
+		if ids, _, err := codec.Encode(text); err == nil {
+			return len(ids)
+		}
+	}
+	return len(text) / 4
+}
+
+// countMessage returns the amount of tokens of a message including its overhead.
+func countMessage(model string, message models.ChatMessage) int {
+	return CountTokens(model, message.Content) + messageOverheadTokens
+}
+
+// contextTokens returns the amount of tokens of the system prompt and the codebase of a request.
+func contextTokens(model string, request *models.ChatRequest) int {
+	tokens := CountTokens(model, SystemPrompt(request)) + messageOverheadTokens
+	if request.Codebase != nil {
+		if request.CodebaseTokenCount != nil {
+			tokens += *request.CodebaseTokenCount + messageOverheadTokens
+		} else {
+			tokens += countMessage(model, CodebaseMessage(*request.Codebase))
+		}
+	}
+	return tokens
+}
+
+// EstimateUsage counts the tokens of a request and its reply locally, for providers that do not report their usage.
+func EstimateUsage(model string, request *models.ChatRequest, reply string) *models.ChatUsage {
+	promptTokens := contextTokens(model, request)
+	for _, message := range request.Messages {
+		promptTokens += countMessage(model, message)
+	}
+	return &models.ChatUsage{
+		PromptTokens:     promptTokens,
+		CompletionTokens: CountTokens(model, reply),
+		Estimated:        true,
+	}
+}
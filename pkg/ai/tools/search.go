@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxGrepMatches is the amount of matching lines returned by a single grep call.
+	maxGrepMatches = 100
+
+	// maxGrepLineLength cuts long matching lines, such as minified code.
+	maxGrepLineLength = 300
+
+	// maxSymbolMatches is the amount of declarations returned by a single get_symbol call.
+	maxSymbolMatches = 10
+
+	// maxSymbolLines is the amount of lines returned from the start of a declaration.
+	maxSymbolLines = 60
+)
+
+// declarationPattern matches the declarations that start with a keyword, optionally after modifiers, in most
+// languages. %s is replaced by the quoted name of the symbol.
+const declarationPattern = `^\s*(?:(?:export|default|public|private|protected|internal|static|abstract|final|async|` +
+	`pub(?:\([^)]*\))?|unsafe|extern|sealed|open|data|inline|virtual|override|declare|readonly)\s+)*` +
+	`(?:func|function\*?|def|fn|class|interface|struct|enum|trait|type|module|protocol|object|record|const|let|var|` +
+	`val|impl|namespace)\s+(?:\([^)]*\)\s*)?%s\b`
+
+// grep searches the files below a path for a regular expression.
+func (t *Toolbox) grep(ctx context.Context, pattern string, within string, ignoreCase bool) (string, error) {
+	if pattern == "" {
+		return "", fmt.Errorf("the pattern is empty")
+	}
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid regular expression (%w)", err)
+	}
+	within, err = cleanPath(within)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := t.filesWithin(ctx, within)
+	if err != nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+	matches := 0
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		content, err := t.readProjectFile(ctx, file)
+		if err != nil {
+			return "", err
+		}
+		for number, line := range strings.Split(content, "\n") {
+			if !expression.MatchString(line) {
+				continue
+			}
+			if matches == maxGrepMatches {
+				sb.WriteString(fmt.Sprintf("[more than %d matches, narrow the search]\n", maxGrepMatches))
+				return limitOutput(sb.String()), nil
+			}
+			line = strings.TrimSpace(line)
+			line = truncateLine(line, maxGrepLineLength)
+			sb.WriteString(fmt.Sprintf("%s:%d: %s\n", file, number+1, line))
+			matches++
+		}
+	}
+	if matches == 0 {
+		return "No matches.", nil
+	}
+	return limitOutput(sb.String()), nil
+}
+
+// getSymbol finds the declarations of a symbol and returns their first lines.
+func (t *Toolbox) getSymbol(ctx context.Context, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("the name is empty")
+	}
+	expression := regexp.MustCompile(fmt.Sprintf(declarationPattern, regexp.QuoteMeta(name)))
+
+	files, err := t.projectFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sb := strings.Builder{}
+	matches := 0
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		content, err := t.readProjectFile(ctx, file)
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(content, "\n")
+		for number, line := range lines {
+			if !expression.MatchString(line) {
+				continue
+			}
+			if matches == maxSymbolMatches {
+				sb.WriteString(fmt.Sprintf("[more than %d declarations, use grep to narrow the search]\n", maxSymbolMatches))
+				return limitOutput(sb.String()), nil
+			}
+			end := min(number+declarationLength(lines[number:]), len(lines))
+			sb.WriteString(fmt.Sprintf("%s, lines %d-%d\n", file, number+1, end))
+			for i := number; i < end; i++ {
+				sb.WriteString(fmt.Sprintf("%d\t%s\n", i+1, lines[i]))
+			}
+			sb.WriteString("\n")
+			matches++
+		}
+	}
+	if matches == 0 {
+		return "", fmt.Errorf("no declaration of %s was found, try grep", name)
+	}
+	return limitOutput(sb.String()), nil
+}
+
+// declarationLength guesses the amount of lines of the declaration starting on the first line. The declaration ends at
+// the first line that is back at its indentation, which is included when it closes a block.
+func declarationLength(lines []string) int {
+	indentation := indentationOf(lines[0])
+	for i := 1; i < len(lines) && i < maxSymbolLines; i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if indentationOf(line) > indentation {
+			continue
+		}
+		// A closing bracket at the indentation of the declaration ends it.
+		if strings.HasPrefix(strings.TrimSpace(line), "}") || strings.HasPrefix(strings.TrimSpace(line), ")") ||
+			strings.HasPrefix(strings.TrimSpace(line), "end") {
+			return i + 1
+		}
+		return i
+	}
+	return min(len(lines), maxSymbolLines)
+}
+
+func indentationOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// filesWithin returns the files of the amalgam that are the given path or are below it.
+func (t *Toolbox) filesWithin(ctx context.Context, within string) ([]string, error) {
+	files, err := t.projectFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if within == "." {
+		return files, nil
+	}
+	selected := make([]string, 0)
+	for _, file := range files {
+		if file == within || strings.HasPrefix(file, within+"/") {
+			selected = append(selected, file)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("the path %s does not exist or has no visible files", within)
+	}
+	return selected, nil
+}
+
+// truncateLine cuts a line to at most maxLength bytes and marks the cut. The cut is moved back to the start of a rune,
+// so a multi-byte character is never split.
+func truncateLine(line string, maxLength int) string {
+	if len(line) <= maxLength {
+		return line
+	}
+	end := maxLength
+	for end > 0 && !utf8.RuneStart(line[end]) {
+		end--
+	}
+	return line[:end] + "..."
+}
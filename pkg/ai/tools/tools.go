@@ -0,0 +1,326 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/charset"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	ToolListDir   = "list_dir"
+	ToolReadFile  = "read_file"
+	ToolGrep      = "grep"
+	ToolGetSymbol = "get_symbol"
+
+	// maxReadLines is the amount of lines returned by a single read_file call.
+	maxReadLines = 1000
+
+	// maxOutputSize is the largest tool output in bytes. Longer outputs are cut at a line boundary.
+	maxOutputSize = 100_000
+)
+
+// Toolbox gives the model read access to the files of a project. Only the files that are part of the amalgam of the
+// project can be seen, so the ignore files, the filter rules and the settings of the project apply to the tools too.
+type Toolbox struct {
+	root    string
+	options *models.AmalgamOptions
+	files   []string
+}
+
+// New creates the tools of the project at root. The amalgam options decide which files are visible and can be nil.
+func New(root string, options *models.AmalgamOptions) (*Toolbox, error) {
+	absoluteRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error getting the absolute path of %s (%w)", root, err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(absoluteRoot)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving the project root %s (%w)", root, err)
+	}
+	return &Toolbox{
+		root:    resolvedRoot,
+		options: options,
+	}, nil
+}
+
+// Tools returns the definitions of the tools sent to the model.
+func (t *Toolbox) Tools() []*ai.Tool {
+	return []*ai.Tool{
+		{
+			Name:        ToolListDir,
+			Description: "Lists the files and the directories in a directory of the project. Directories end with a slash.",
+			Parameters: objectSchema(map[string]any{
+				"path": stringSchema("The directory, relative to the project root. Use . for the root."),
+			}, "path"),
+		},
+		{
+			Name:        ToolReadFile,
+			Description: fmt.Sprintf("Reads a file of the project. The lines are numbered, and at most %d lines are returned per call.", maxReadLines),
+			Parameters: objectSchema(map[string]any{
+				"path":       stringSchema("The file, relative to the project root."),
+				"start_line": integerSchema("The first line to read, starting at 1. Defaults to 1."),
+				"end_line":   integerSchema("The last line to read. Defaults to the end of the file."),
+			}, "path"),
+		},
+		{
+			Name:        ToolGrep,
+			Description: fmt.Sprintf("Searches the files of the project for a regular expression in the RE2 syntax. Returns at most %d matching lines as path:line: text.", maxGrepMatches),
+			Parameters: objectSchema(map[string]any{
+				"pattern":     stringSchema("The regular expression."),
+				"path":        stringSchema("Limits the search to a file or a directory, relative to the project root."),
+				"ignore_case": map[string]any{"type": "boolean", "description": "Matches without regard to case."},
+			}, "pattern"),
+		},
+		{
+			Name:        ToolGetSymbol,
+			Description: "Finds the declarations of a function, method, type, class or variable by its name and returns their source.",
+			Parameters: objectSchema(map[string]any{
+				"name": stringSchema("The name of the symbol, without its package or class."),
+			}, "name"),
+		},
+	}
+}
+
+// Execute runs a tool call of the model. The errors are meant to be read by the model.
+func (t *Toolbox) Execute(ctx context.Context, call *ai.ToolCall) (string, error) {
+	switch call.Name {
+	case ToolListDir:
+		args := &struct {
+			Path string `json:"path"`
+		}{}
+		if err := parseArguments(call, args); err != nil {
+			return "", err
+		}
+		return t.listDir(ctx, args.Path)
+	case ToolReadFile:
+		args := &struct {
+			Path      string `json:"path"`
+			StartLine int    `json:"start_line"`
+			EndLine   int    `json:"end_line"`
+		}{}
+		if err := parseArguments(call, args); err != nil {
+			return "", err
+		}
+		return t.readFile(ctx, args.Path, args.StartLine, args.EndLine)
+	case ToolGrep:
+		args := &struct {
+			Pattern    string `json:"pattern"`
+			Path       string `json:"path"`
+			IgnoreCase bool   `json:"ignore_case"`
+		}{}
+		if err := parseArguments(call, args); err != nil {
+			return "", err
+		}
+		return t.grep(ctx, args.Pattern, args.Path, args.IgnoreCase)
+	case ToolGetSymbol:
+		args := &struct {
+			Name string `json:"name"`
+		}{}
+		if err := parseArguments(call, args); err != nil {
+			return "", err
+		}
+		return t.getSymbol(ctx, args.Name)
+	default:
+		return "", fmt.Errorf("unknown tool '%s'", call.Name)
+	}
+}
+
+func parseArguments(call *ai.ToolCall, args any) error {
+	arguments := strings.TrimSpace(call.Arguments)
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if err := json.Unmarshal([]byte(arguments), args); err != nil {
+		return fmt.Errorf("invalid arguments for %s (%w)", call.Name, err)
+	}
+	return nil
+}
+
+// projectFiles returns the slash separated paths of the files of the amalgam, sorted. They are listed on first use
+// with the same rules as the amalgam, and symbolic links to files outside of the root are left out.
+func (t *Toolbox) projectFiles(ctx context.Context) ([]string, error) {
+	if t.files != nil {
+		return t.files, nil
+	}
+	infos, err := amalgam.List(ctx, t.root, t.options)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the project files (%w)", err)
+	}
+	files := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if _, err := t.resolve(info.Path); err != nil {
+			logger.Debugf("Hiding %s from the agent (%s).", info.Path, err.Error())
+			continue
+		}
+		files = append(files, info.Path)
+	}
+	slices.Sort(files)
+	t.files = files
+	return t.files, nil
+}
+
+// cleanPath validates a path given by the model and returns it slash separated and relative to the root, with "."
+// for the root. Absolute paths and paths that leave the root are rejected.
+func cleanPath(relativePath string) (string, error) {
+	relativePath = strings.TrimSpace(filepath.ToSlash(relativePath))
+	if relativePath == "" {
+		return ".", nil
+	}
+	if path.IsAbs(relativePath) || filepath.IsAbs(relativePath) || filepath.VolumeName(relativePath) != "" {
+		return "", fmt.Errorf("the path %s must be relative to the project root", relativePath)
+	}
+	cleaned := path.Clean(relativePath)
+	if !filepath.IsLocal(filepath.FromSlash(cleaned)) {
+		return "", fmt.Errorf("the path %s is outside of the project", relativePath)
+	}
+	return cleaned, nil
+}
+
+// resolve returns the absolute path of a file of the project. Symbolic links are followed, and the file is rejected if
+// its target is outside of the root.
+func (t *Toolbox) resolve(relativePath string) (string, error) {
+	absolutePath := filepath.Join(t.root, filepath.FromSlash(relativePath))
+	resolvedPath, err := filepath.EvalSymlinks(absolutePath)
+	if err != nil {
+		return "", fmt.Errorf("the file %s cannot be read (%w)", relativePath, err)
+	}
+	rel, err := filepath.Rel(t.root, resolvedPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("the file %s is outside of the project", relativePath)
+	}
+	return resolvedPath, nil
+}
+
+// readProjectFile reads a file of the amalgam as UTF-8 text.
+func (t *Toolbox) readProjectFile(ctx context.Context, relativePath string) (string, error) {
+	files, err := t.projectFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+	if _, found := slices.BinarySearch(files, relativePath); !found {
+		return "", fmt.Errorf("the file %s does not exist or is excluded from the project", relativePath)
+	}
+	absolutePath, err := t.resolve(relativePath)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(absolutePath)
+	if err != nil {
+		return "", fmt.Errorf("error reading the file %s (%w)", relativePath, err)
+	}
+	text, _, _ := charset.ToUTF8(content)
+	return text, nil
+}
+
+func (t *Toolbox) listDir(ctx context.Context, directory string) (string, error) {
+	directory, err := cleanPath(directory)
+	if err != nil {
+		return "", err
+	}
+	files, err := t.projectFiles(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ""
+	if directory != "." {
+		prefix = directory + "/"
+	}
+	entries := make([]string, 0)
+	for _, file := range files {
+		rest, inDirectory := strings.CutPrefix(file, prefix)
+		if !inDirectory {
+			continue
+		}
+		entry := rest
+		if child, _, isNested := strings.Cut(rest, "/"); isNested {
+			entry = child + "/"
+		}
+		if len(entries) == 0 || entries[len(entries)-1] != entry {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		if _, isFile := slices.BinarySearch(files, directory); isFile {
+			return "", fmt.Errorf("%s is a file, not a directory", directory)
+		}
+		return "", fmt.Errorf("the directory %s does not exist or has no visible files", directory)
+	}
+
+	// Files sort before the directories that share their prefix, so the entries are sorted again.
+	slices.Sort(entries)
+	entries = slices.Compact(entries)
+	return limitOutput(strings.Join(entries, "\n")), nil
+}
+
+func (t *Toolbox) readFile(ctx context.Context, filePath string, startLine int, endLine int) (string, error) {
+	filePath, err := cleanPath(filePath)
+	if err != nil {
+		return "", err
+	}
+	content, err := t.readProjectFile(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	startLine = max(startLine, 1)
+	if endLine <= 0 || endLine > len(lines) {
+		endLine = len(lines)
+	}
+	if startLine > endLine {
+		return "", fmt.Errorf("the file %s has %d lines, the range %d-%d is empty", filePath, len(lines), startLine, endLine)
+	}
+	endLine = min(endLine, startLine+maxReadLines-1)
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%s, lines %d-%d of %d\n", filePath, startLine, endLine, len(lines)))
+	for number := startLine; number <= endLine; number++ {
+		sb.WriteString(fmt.Sprintf("%d\t%s\n", number, lines[number-1]))
+	}
+	return limitOutput(sb.String()), nil
+}
+
+// limitOutput cuts an output that is longer than maxOutputSize at the last line that fits.
+func limitOutput(output string) string {
+	if len(output) <= maxOutputSize {
+		return output
+	}
+	cut := strings.LastIndexByte(output[:maxOutputSize], '\n')
+	if cut < 0 {
+		// A single line is cut at the start of a rune, so a multi-byte character is never split.
+		cut = maxOutputSize
+		for cut > 0 && !utf8.RuneStart(output[cut]) {
+			cut--
+		}
+	}
+	return output[:cut] + "\n[output truncated]"
+}
+
+func objectSchema(properties map[string]any, required ...string) map[string]any {
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func stringSchema(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func integerSchema(description string) map[string]any {
+	return map[string]any{"type": "integer", "description": description}
+}
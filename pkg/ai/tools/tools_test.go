@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+)
+
+func TestToolsOnlySeeTheFilesOfTheAmalgam(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"main.go":      "package main\n\n// Needle is read by the agent.\nvar Needle = 1\n",
+		"generated.go": "// Code generated by a tool. DO NOT EDIT.\n\npackage main\n\nvar Needle = 2\n",
+		"binary.go":    "package main\x00\x01Needle\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s (%s)", name, err)
+		}
+	}
+	toolbox, err := New(root, nil)
+	if err != nil {
+		t.Fatalf("failed to create the tools (%s)", err)
+	}
+
+	output, err := toolbox.Execute(context.Background(), &ai.ToolCall{Name: ToolGrep, Arguments: `{"pattern": "Needle"}`})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !strings.Contains(output, "main.go:") || strings.Contains(output, "generated.go") || strings.Contains(output, "binary.go") {
+		t.Fatalf("expected only main.go to match, got %q", output)
+	}
+
+	for _, name := range []string{"generated.go", "binary.go"} {
+		if _, err := toolbox.Execute(context.Background(), &ai.ToolCall{Name: ToolReadFile, Arguments: `{"path": "` + name + `"}`}); err == nil {
+			t.Fatalf("expected %s to be hidden from read_file", name)
+		}
+	}
+}
+
+func TestTruncateLine(t *testing.T) {
+	testCases := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{
+			name:     "short line",
+			line:     "hé",
+			expected: "hé",
+		},
+		{
+			name:     "cut on a rune boundary",
+			line:     "abcdef",
+			expected: "abcd...",
+		},
+		{
+			name:     "cut inside a rune",
+			line:     "abcé",
+			expected: "abc...",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			truncated := truncateLine(testCase.line, 4)
+			if truncated != testCase.expected || !utf8.ValidString(truncated) {
+				t.Fatalf("expected %q, got %q", testCase.expected, truncated)
+			}
+		})
+	}
+}
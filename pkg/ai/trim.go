@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// defaultReservedOutputTokens is kept free in the context window for the reply when the request does not set a
+	// maximum amount of output tokens.
+	defaultReservedOutputTokens = 4096
+)
+
+// ContextWindowError is returned when the codebase and the latest question alone do not fit in the context window of
+// the model, so the amalgam or the question has to be narrowed.
+type ContextWindowError struct {
+	Model     string
+	Needed    int
+	Available int
+}
+
+func (e *ContextWindowError) Error() string {
+	return fmt.Sprintf("the codebase and the latest question need %d tokens, but the model %s has room for %d", e.Needed, e.Model, e.Available)
+}
+
+// Trim drops the oldest turns of the conversation until the instructions, the codebase, the history and the reply
+// fit in the context window of the model. The codebase and the latest question are always kept. It returns nil when
+// nothing was dropped, and a *ContextWindowError when the codebase and the latest question alone do not fit.
+func Trim(request *models.ChatRequest, model string, contextWindow int) (*models.ChatTrimmed, error) {
+	budget := contextWindow - reservedOutputTokens(request.Generation)
+	used := contextTokens(model, request)
+
+	messageTokens := make([]int, len(request.Messages))
+	for i, message := range request.Messages {
+		messageTokens[i] = countMessage(model, message)
+		used += messageTokens[i]
+	}
+	if used <= budget {
+		return nil, nil
+	}
+
+	// The latest question and the messages after it are never dropped.
+	keepFrom := len(request.Messages) - 1
+	for keepFrom > 0 && request.Messages[keepFrom].Role != models.ChatRoleUser {
+		keepFrom--
+	}
+
+	trimmed := &models.ChatTrimmed{}
+	start := 0
+	for used > budget && start < keepFrom {
+		// Whole turns are dropped, from a user message up to the next one, so the roles keep alternating.
+		end := start + 1
+		for end < keepFrom && request.Messages[end].Role != models.ChatRoleUser {
+			end++
+		}
+		for i := start; i < end; i++ {
+			used -= messageTokens[i]
+			trimmed.Tokens += messageTokens[i]
+			trimmed.Messages++
+		}
+		start = end
+	}
+	if used > budget {
+		return nil, &ContextWindowError{Model: model, Needed: used, Available: budget}
+	}
+
+	request.Messages = request.Messages[start:]
+	return trimmed, nil
+}
+
+func reservedOutputTokens(options *models.GenerationOptions) int {
+	if options != nil && options.MaxOutputTokens != nil {
+		return *options.MaxOutputTokens
+	}
+	return defaultReservedOutputTokens
+}
+
+// WithTrimmed forwards a token stream and reports what was trimmed from the conversation on its final message.
+func WithTrimmed(ctx context.Context, tokens <-chan *models.ChatResponse, trimmed *models.ChatTrimmed) <-chan *models.ChatResponse {
+	forwarded := make(chan *models.ChatResponse)
+	go func() {
+		defer close(forwarded)
+		for msg := range tokens {
+			if msg.Done != nil && *msg.Done {
+				msg.Trimmed = trimmed
+			}
+			if !SendOverChannel(ctx, forwarded, msg) {
+				return
+			}
+		}
+	}()
+	return forwarded
+}
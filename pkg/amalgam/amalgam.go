@@ -2,36 +2,62 @@ package amalgam
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/tiktoken-go/tokenizer"
 
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/charset"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/language"
 	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
 	baseconfig "github.com/TriangleSide/GoTools/pkg/config"
 	"github.com/TriangleSide/GoTools/pkg/logger"
 )
 
 var (
-	allowedExactFiles    = make(map[string]struct{})
-	allowedSuffix        = make(map[string]struct{})
-	disallowedExactPaths = make(map[string]struct{})
-	disallowedSuffix     = make(map[string]struct{})
+	allowedExactFiles       = make(map[string]struct{})
+	allowedSuffix           = make(map[string]struct{})
+	allowedLanguages        = make(map[string]struct{})
+	disallowedExactPaths    = make(map[string]struct{})
+	disallowedSuffix        = make(map[string]struct{})
+	testSuffix              = make(map[string]struct{})
+	generatedSuffix         = make(map[string]struct{})
+	vendoredDirectories     = make(map[string]struct{})
+	lockFiles               = make(map[string]struct{})
+	ignoreFiles             = make([]string, 0)
+	maxFileSize             int64
+	notebookMaxOutputLength int
 )
 
 var (
 	tokenizerCodec tokenizer.Codec
 )
 
+// File is a file of the amalgam with its content, for the indexes built from the files of a project.
+type File struct {
+	Path     string
+	Language string
+	Content  string
+	Hash     string
+}
+
 type fileContent struct {
-	Path    string
-	Content string
-	Imports []string
-	Package string
+	Path      string
+	Content   string
+	Language  string
+	Encoding  string
+	Converted bool
+	Imports   []string
+	Package   string
 }
 
 func init() {
@@ -40,9 +66,34 @@ func init() {
 		logger.Fatalf("Failed to read the configuration (%s)", err.Error())
 	}
 	if tokenizerCodec, err = tokenizer.ForModel(tokenizer.Model(cfg.ModelVersion)); err != nil {
-		logger.Fatalf("Unable to get tokenizer codec for %s model.", cfg.ModelVersion)
+		// Models of other providers are not known to the tokenizer, the count is an estimate for them.
+		logger.Warnf("No tokenizer for the %s model, estimating token counts with %s.", cfg.ModelVersion, tokenizer.Cl100kBase)
+		if tokenizerCodec, err = tokenizer.Get(tokenizer.Cl100kBase); err != nil {
+			logger.Fatalf("Unable to get the %s tokenizer codec.", tokenizer.Cl100kBase)
+		}
+	}
+	loadConfig(findConfig("amalgam.json"))
+}
+
+// findConfig returns the path of the configuration file in the working directory, or in the closest parent directory
+// that has it, so that the tests of the packages that use the amalgam find the file of the repository. The name is
+// returned as is when no directory has it.
+func findConfig(name string) string {
+	directory, err := os.Getwd()
+	if err != nil {
+		return name
+	}
+	for {
+		candidate := filepath.Join(directory, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return name
+		}
+		directory = parent
 	}
-	loadConfig("amalgam.json")
 }
 
 func loadConfig(filepath string) {
@@ -52,10 +103,18 @@ func loadConfig(filepath string) {
 	}
 
 	type AmalgamConfig struct {
-		AllowedExactFiles    []string `json:"allowedExactFiles"`
-		AllowedSuffix        []string `json:"allowedSuffix"`
-		DisallowedExactPaths []string `json:"disallowedExactPaths"`
-		DisallowedSuffix     []string `json:"disallowedSuffix"`
+		AllowedExactFiles       []string `json:"allowedExactFiles"`
+		AllowedSuffix           []string `json:"allowedSuffix"`
+		AllowedLanguages        []string `json:"allowedLanguages"`
+		DisallowedExactPaths    []string `json:"disallowedExactPaths"`
+		DisallowedSuffix        []string `json:"disallowedSuffix"`
+		TestSuffix              []string `json:"testSuffix"`
+		GeneratedSuffix         []string `json:"generatedSuffix"`
+		VendoredDirectories     []string `json:"vendoredDirectories"`
+		LockFiles               []string `json:"lockFiles"`
+		IgnoreFiles             []string `json:"ignoreFiles"`
+		MaxFileSize             int64    `json:"maxFileSize"`
+		NotebookMaxOutputLength int      `json:"notebookMaxOutputLength"`
 	}
 	var amalgamConfig AmalgamConfig
 
@@ -69,91 +128,313 @@ func loadConfig(filepath string) {
 	for _, suffix := range amalgamConfig.AllowedSuffix {
 		allowedSuffix[suffix] = struct{}{}
 	}
+	for _, lang := range amalgamConfig.AllowedLanguages {
+		allowedLanguages[strings.ToLower(lang)] = struct{}{}
+	}
 	for _, path := range amalgamConfig.DisallowedExactPaths {
 		disallowedExactPaths[path] = struct{}{}
 	}
 	for _, suffix := range amalgamConfig.DisallowedSuffix {
 		disallowedSuffix[suffix] = struct{}{}
 	}
+	for _, suffix := range amalgamConfig.TestSuffix {
+		testSuffix[suffix] = struct{}{}
+	}
+	for _, suffix := range amalgamConfig.GeneratedSuffix {
+		generatedSuffix[suffix] = struct{}{}
+	}
+	for _, directory := range amalgamConfig.VendoredDirectories {
+		vendoredDirectories[strings.ToLower(directory)] = struct{}{}
+	}
+	for _, file := range amalgamConfig.LockFiles {
+		lockFiles[file] = struct{}{}
+	}
+	ignoreFiles = append(ignoreFiles, amalgamConfig.IgnoreFiles...)
+	maxFileSize = amalgamConfig.MaxFileSize
+	notebookMaxOutputLength = amalgamConfig.NotebookMaxOutputLength
+	registerPreprocessors()
+}
+
+// OptionsError is returned when the request-time overrides are invalid.
+type OptionsError struct {
+	Err error
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("invalid amalgam options (%s)", e.Err.Error())
+}
+
+func (e *OptionsError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateOptions checks the request-time overrides before they are applied. The error is an *OptionsError.
+func ValidateOptions(options *models.AmalgamOptions) error {
+	if options == nil {
+		return nil
+	}
+	for _, pattern := range append(append([]string{}, options.Include...), options.Exclude...) {
+		if err := validateGlob(pattern); err != nil {
+			return &OptionsError{Err: err}
+		}
+	}
+	return nil
 }
 
-func Get(ctx context.Context, root string) (string, int, error) {
-	files, err := collectFiles(root)
+// Get builds the amalgam of the project at root. The options are request-time overrides merged on top of the
+// configured rules, and they can be nil. The response can be shared with other callers through the cache, so it must
+// not be modified.
+func Get(ctx context.Context, root string, options *models.AmalgamOptions) (*models.AmalgamResponse, error) {
+	if options == nil {
+		options = &models.AmalgamOptions{}
+	}
+	if err := ValidateOptions(options); err != nil {
+		return nil, err
+	}
+
+	cached, generation, ok := cache.lookup(root, options)
+	if ok {
+		return cached, nil
+	}
+
+	response, err := build(ctx, root, options)
 	if err != nil {
-		return "", -1, err
+		return nil, err
 	}
+	cache.store(root, options, generation, response)
+
+	return response, nil
+}
 
-	fileContents, err := readFiles(root, files)
+func build(ctx context.Context, root string, options *models.AmalgamOptions) (*models.AmalgamResponse, error) {
+	files, exclusions, err := collectFiles(ctx, root, options)
 	if err != nil {
-		return "", -1, err
+		return nil, err
 	}
 
+	fileContents, failures, err := readFiles(root, files)
+	if err != nil {
+		return nil, err
+	}
+	exclusions.Unparsable = failures
+
 	sb := strings.Builder{}
+	amalgamFiles := make([]*models.AmalgamFile, 0, len(fileContents))
 	for _, fc := range fileContents {
-		sb.WriteString(fmt.Sprintf("// File: %s\n\n%s\n\n", fc.Path, strings.TrimSpace(fc.Content)))
+		if fc.Language != "" {
+			sb.WriteString(fmt.Sprintf("// File: %s\n// Language: %s\n\n%s\n\n", fc.Path, fc.Language, strings.TrimSpace(fc.Content)))
+		} else {
+			sb.WriteString(fmt.Sprintf("// File: %s\n\n%s\n\n", fc.Path, strings.TrimSpace(fc.Content)))
+		}
+		amalgamFile := &models.AmalgamFile{
+			Path:     fc.Path,
+			Language: fc.Language,
+			Hash:     fileHash(fc),
+		}
+		if fc.Converted {
+			amalgamFile.Encoding = fc.Encoding
+			amalgamFile.Converted = true
+		}
+		amalgamFiles = append(amalgamFiles, amalgamFile)
 	}
 
 	amalgamStr := sb.String()
 	tokenIds, _, err := tokenizerCodec.Encode(amalgamStr)
 	if err != nil {
-		return amalgamStr, -1, err
+		return nil, err
 	}
 
-	return amalgamStr, len(tokenIds), nil
+	return &models.AmalgamResponse{
+		Hash:       contentHash(amalgamFiles, exclusions),
+		Content:    amalgamStr,
+		TokenCount: len(tokenIds),
+		Files:      amalgamFiles,
+		Excluded:   exclusions,
+	}, nil
+}
+
+// fileHash returns the SHA-256 of a file as it appears in the amalgam.
+func fileHash(fc fileContent) string {
+	hash := sha256.New()
+	hash.Write([]byte(fc.Language))
+	hash.Write([]byte{0})
+	hash.Write([]byte(fc.Content))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// contentHash returns a SHA-256 over the sorted paths and hashes of the files of an amalgam and over its exclusions.
+// It only changes when the response changes, so it can be used as an entity tag.
+func contentHash(files []*models.AmalgamFile, exclusions *models.AmalgamExclusions) string {
+	sorted := slices.Clone(files)
+	slices.SortFunc(sorted, func(a, b *models.AmalgamFile) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	hash := sha256.New()
+	for _, file := range sorted {
+		hash.Write([]byte(file.Path))
+		hash.Write([]byte{0})
+		hash.Write([]byte(file.Hash))
+		hash.Write([]byte{'\n'})
+	}
+	excluded, err := json.Marshal(exclusions)
+	if err != nil {
+		panic(err)
+	}
+	hash.Write(excluded)
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
-func collectFiles(root string) ([]string, error) {
+func collectFiles(ctx context.Context, root string, options *models.AmalgamOptions) ([]string, *models.AmalgamExclusions, error) {
 	var files []string
+	exclusions := &models.AmalgamExclusions{}
 
-	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	err := walk(ctx, root, newFilterOptions(options), func(relativePath string, info os.FileInfo, d *decision) error {
+		if info.IsDir() && d.included {
+			return nil
 		}
-
-		pathParts := strings.Split(path, string(filepath.Separator))
-		for _, pathPart := range pathParts {
-			if _, hasPathPart := disallowedExactPaths[strings.ToLower(pathPart)]; hasPathPart {
-				return nil
-			}
+		if d.included {
+			files = append(files, filepath.Join(root, filepath.FromSlash(relativePath)))
+			return nil
+		}
+		switch d.rule {
+		case RuleGenerated:
+			exclusions.Generated++
+		case RuleVendored:
+			exclusions.VendoredDirectories++
+		case RuleLockFile:
+			exclusions.LockFiles++
 		}
+		return nil
+	})
 
-		if !info.IsDir() {
-			_, file := filepath.Split(path)
-			for disallowed := range disallowedSuffix {
-				if strings.HasSuffix(strings.ToLower(file), strings.ToLower(disallowed)) {
-					return nil
-				}
-			}
+	if err != nil {
+		return nil, nil, err
+	}
 
-			if _, ok := allowedExactFiles[file]; ok {
-				files = append(files, path)
-				return nil
-			}
+	return files, exclusions, nil
+}
 
-			ext := filepath.Ext(path)
-			if _, ok := allowedSuffix[ext]; ok {
-				files = append(files, path)
-				return nil
-			}
-		}
+// FileInfo is a file of the amalgam without its content, for the indexes that only read the files that changed.
+type FileInfo struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
 
+// List returns the files of the project at root that are part of its amalgam, without reading them. The paths are
+// relative to the root and slash separated.
+func List(ctx context.Context, root string, options *models.AmalgamOptions) ([]*FileInfo, error) {
+	if options == nil {
+		options = &models.AmalgamOptions{}
+	}
+	if err := ValidateOptions(options); err != nil {
+		return nil, err
+	}
+
+	files := make([]*FileInfo, 0)
+	err := walk(ctx, root, newFilterOptions(options), func(relativePath string, info os.FileInfo, d *decision) error {
+		if d.included && !info.IsDir() {
+			files = append(files, &FileInfo{
+				Path:    relativePath,
+				ModTime: info.ModTime(),
+				Size:    info.Size(),
+			})
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
 
+// Read reads files of the project at root with the preprocessing of the amalgam. The paths are relative to the root
+// and slash separated, as returned by List.
+func Read(root string, paths []string) ([]*File, error) {
+	absolutePaths := make([]string, 0, len(paths))
+	for _, relativePath := range paths {
+		absolutePaths = append(absolutePaths, filepath.Join(root, filepath.FromSlash(relativePath)))
+	}
+	fileContents, _, err := readFiles(root, absolutePaths)
 	if err != nil {
 		return nil, err
 	}
 
+	files := make([]*File, 0, len(fileContents))
+	for _, fc := range fileContents {
+		files = append(files, &File{
+			Path:     filepath.ToSlash(fc.Path),
+			Language: fc.Language,
+			Content:  fc.Content,
+			Hash:     fileHash(fc),
+		})
+	}
 	return files, nil
 }
 
-func readFiles(root string, files []string) ([]fileContent, error) {
+// Files reads the files of the project at root that are part of its amalgam, with the same rules and preprocessing.
+// The paths are relative to the root and slash separated.
+func Files(ctx context.Context, root string, options *models.AmalgamOptions) ([]*File, error) {
+	infos, err := List(ctx, root, options)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(infos))
+	for _, info := range infos {
+		paths = append(paths, info.Path)
+	}
+	return Read(root, paths)
+}
+
+// Explain walks the project at root and reports the decision of the filter rules for every file and every excluded
+// directory. It applies the same rules as the amalgam, so the rules that need the content of a file only read the
+// bounded head and tail that List reads, and only for the files that pass the rules on their path.
+func Explain(ctx context.Context, root string, options *models.AmalgamOptions) (*models.AmalgamExplainResponse, error) {
+	if options == nil {
+		options = &models.AmalgamOptions{}
+	}
+	if err := ValidateOptions(options); err != nil {
+		return nil, err
+	}
+
+	response := &models.AmalgamExplainResponse{
+		Entries: make([]*models.AmalgamExplainEntry, 0),
+	}
+	err := walk(ctx, root, newFilterOptions(options), func(relativePath string, info os.FileInfo, d *decision) error {
+		if info.IsDir() && d.included {
+			return nil
+		}
+		response.Entries = append(response.Entries, &models.AmalgamExplainEntry{
+			Path:      relativePath,
+			Directory: info.IsDir(),
+			Included:  d.included,
+			Rule:      d.rule,
+			Detail:    d.detail,
+		})
+		if d.included {
+			response.IncludedCount++
+		} else {
+			response.ExcludedCount++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// readFiles reads and preprocesses files. A file that its preprocessor cannot parse is left out and returned with the
+// reason in the failures.
+func readFiles(root string, files []string) ([]fileContent, []*models.AmalgamFileError, error) {
 	var fileContents []fileContent
+	failures := make([]*models.AmalgamFileError, 0)
 
 	for _, file := range files {
 		content, err := os.ReadFile(file)
 		if err != nil {
-			return nil, fmt.Errorf("error reading file %s (%w)", file, err)
+			return nil, nil, fmt.Errorf("error reading file %s (%w)", file, err)
 		}
 
 		relativePath, err := filepath.Rel(root, file)
@@ -161,15 +442,36 @@ func readFiles(root string, files []string) ([]fileContent, error) {
 			panic(fmt.Errorf("error getting relative path for file %s and root %s", file, root))
 		}
 
+		text, encoding, converted := charset.ToUTF8(content)
+		if converted {
+			logger.Debugf("Converted %s from %s to UTF-8.", relativePath, encoding)
+		}
+
+		if preprocess, ok := preprocessorFor(file); ok {
+			processed, err := preprocess([]byte(text))
+			if err != nil {
+				logger.Warnf("Failed to preprocess %s, leaving it out of the amalgam (%s).", relativePath, err.Error())
+				failures = append(failures, &models.AmalgamFileError{
+					Path:  filepath.ToSlash(relativePath),
+					Error: err.Error(),
+				})
+				continue
+			}
+			text = processed
+		}
+
 		fc := fileContent{
-			Path:    relativePath,
-			Content: string(content),
-			Imports: make([]string, 0),
-			Package: "",
+			Path:      relativePath,
+			Content:   text,
+			Language:  language.Detect(file, []byte(text)),
+			Encoding:  encoding,
+			Converted: converted,
+			Imports:   make([]string, 0),
+			Package:   "",
 		}
 
 		fileContents = append(fileContents, fc)
 	}
 
-	return fileContents, nil
+	return fileContents, failures, nil
 }
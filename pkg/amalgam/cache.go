@@ -0,0 +1,143 @@
+package amalgam
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// maxCacheEntries is the maximum amount of amalgams cached over all the roots. The least recently used amalgam is
+	// dropped when a new one would exceed it, since every set of request-time options gets its own entry.
+	maxCacheEntries = 32
+)
+
+// cache holds the amalgams built for the roots that are watched for changes. Roots that are not watched are never
+// cached since nothing would invalidate their entries.
+var cache = &amalgamCache{
+	roots: make(map[string]*rootCache),
+}
+
+type cacheEntry struct {
+	response *models.AmalgamResponse
+	lastUsed uint64
+}
+
+type rootCache struct {
+	generation uint64
+	entries    map[string]*cacheEntry
+}
+
+type amalgamCache struct {
+	mutex sync.Mutex
+	roots map[string]*rootCache
+	clock uint64
+	size  int
+
+	// generations is the last generation given to a root. It is shared by all the roots and never reset, so a build
+	// that started before its root was disabled cannot be stored once the root is enabled again.
+	generations uint64
+}
+
+// EnableCache starts caching the amalgams of root. The caller must call Invalidate whenever a file under root changes.
+func EnableCache(root string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if _, ok := cache.roots[root]; !ok {
+		cache.generations++
+		cache.roots[root] = &rootCache{
+			generation: cache.generations,
+			entries:    make(map[string]*cacheEntry),
+		}
+	}
+}
+
+// DisableCache stops caching the amalgams of root and drops its entries.
+func DisableCache(root string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if rc, ok := cache.roots[root]; ok {
+		cache.size -= len(rc.entries)
+		delete(cache.roots, root)
+	}
+}
+
+// Invalidate drops the cached amalgams of root, whatever options they were built with.
+func Invalidate(root string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if rc, ok := cache.roots[root]; ok {
+		cache.generations++
+		rc.generation = cache.generations
+		cache.size -= len(rc.entries)
+		rc.entries = make(map[string]*cacheEntry)
+	}
+}
+
+// lookup returns the cached amalgam of root for the options. The generation must be passed to store so that an
+// amalgam built while the root was invalidated is not cached.
+func (c *amalgamCache) lookup(root string, options *models.AmalgamOptions) (*models.AmalgamResponse, uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	rc, ok := c.roots[root]
+	if !ok {
+		return nil, 0, false
+	}
+	entry, ok := rc.entries[cacheKey(options)]
+	if !ok {
+		return nil, rc.generation, false
+	}
+	c.clock++
+	entry.lastUsed = c.clock
+	return entry.response, rc.generation, true
+}
+
+func (c *amalgamCache) store(root string, options *models.AmalgamOptions, generation uint64, response *models.AmalgamResponse) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	rc, ok := c.roots[root]
+	if !ok || rc.generation != generation {
+		return
+	}
+
+	key := cacheKey(options)
+	if _, exists := rc.entries[key]; !exists {
+		for c.size >= maxCacheEntries {
+			c.evictOldest()
+		}
+		c.size++
+	}
+	c.clock++
+	rc.entries[key] = &cacheEntry{
+		response: response,
+		lastUsed: c.clock,
+	}
+}
+
+// evictOldest drops the least recently used amalgam over all the roots. The caller must hold the mutex.
+func (c *amalgamCache) evictOldest() {
+	var oldestRoot *rootCache
+	oldestKey := ""
+	for _, rc := range c.roots {
+		for key, entry := range rc.entries {
+			if oldestRoot == nil || entry.lastUsed < oldestRoot.entries[oldestKey].lastUsed {
+				oldestRoot, oldestKey = rc, key
+			}
+		}
+	}
+	if oldestRoot == nil {
+		c.size = 0
+		return
+	}
+	delete(oldestRoot.entries, oldestKey)
+	c.size--
+}
+
+func cacheKey(options *models.AmalgamOptions) string {
+	key, err := json.Marshal(options)
+	if err != nil {
+		panic(err)
+	}
+	return string(key)
+}
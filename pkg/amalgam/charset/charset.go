@@ -0,0 +1,191 @@
+package charset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	UTF8        = "UTF-8"
+	UTF8BOM     = "UTF-8 with BOM"
+	UTF16LE     = "UTF-16LE"
+	UTF16BE     = "UTF-16BE"
+	UTF32LE     = "UTF-32LE"
+	UTF32BE     = "UTF-32BE"
+	Windows1252 = "Windows-1252"
+)
+
+const (
+	// wideSniffSize is the amount of bytes inspected when looking for UTF-16 text without a byte order mark.
+	wideSniffSize = 1024
+
+	// wideThreshold is the fraction of code units that must have a NUL high byte for text without a byte order mark
+	// to be considered UTF-16.
+	wideThreshold = 0.7
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF32LE = []byte{0xFF, 0xFE, 0x00, 0x00}
+	bomUTF32BE = []byte{0x00, 0x00, 0xFE, 0xFF}
+)
+
+// windows1252 maps the bytes 0x80 to 0x9F to their characters. The other bytes above 0x7F are the same as Latin-1.
+// The five bytes left undefined by Windows-1252 are mapped to the C1 control characters, like Latin-1 does.
+var windows1252 = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// Detect returns the encoding of content. Byte order marks are trusted, UTF-16 without a byte order mark is recognized
+// by its NUL bytes, and content that is not valid UTF-8 is assumed to be Windows-1252.
+func Detect(content []byte) string {
+	switch {
+	case bytes.HasPrefix(content, bomUTF32LE):
+		return UTF32LE
+	case bytes.HasPrefix(content, bomUTF32BE):
+		return UTF32BE
+	case bytes.HasPrefix(content, bomUTF8):
+		return UTF8BOM
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return UTF16LE
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return UTF16BE
+	}
+
+	if wide := detectWide(content); wide != "" {
+		return wide
+	}
+	if utf8.Valid(content) || mostlyUTF8(content) {
+		return UTF8
+	}
+	return Windows1252
+}
+
+// IsWide reports whether an encoding stores ASCII characters with NUL bytes.
+func IsWide(encoding string) bool {
+	switch encoding {
+	case UTF16LE, UTF16BE, UTF32LE, UTF32BE:
+		return true
+	default:
+		return false
+	}
+}
+
+// ToUTF8 converts content to valid UTF-8. It returns the text, the detected source encoding, and whether the text
+// differs from the raw bytes because it was transcoded, had its byte order mark removed, or had invalid sequences
+// replaced.
+func ToUTF8(content []byte) (text string, encoding string, converted bool) {
+	encoding = Detect(content)
+	switch encoding {
+	case UTF8BOM:
+		return strings.ToValidUTF8(string(content[len(bomUTF8):]), string(utf8.RuneError)), encoding, true
+	case UTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(content, bomUTF16LE), binary.LittleEndian), encoding, true
+	case UTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(content, bomUTF16BE), binary.BigEndian), encoding, true
+	case UTF32LE:
+		return decodeUTF32(content[len(bomUTF32LE):], binary.LittleEndian), encoding, true
+	case UTF32BE:
+		return decodeUTF32(content[len(bomUTF32BE):], binary.BigEndian), encoding, true
+	case Windows1252:
+		return decodeWindows1252(content), encoding, true
+	default:
+		if utf8.Valid(content) {
+			return string(content), encoding, false
+		}
+		return strings.ToValidUTF8(string(content), string(utf8.RuneError)), encoding, true
+	}
+}
+
+// detectWide recognizes UTF-16 without a byte order mark from ASCII characters stored with a NUL high byte.
+func detectWide(content []byte) string {
+	sample := content[:min(len(content), wideSniffSize)]
+	units := len(sample) / 2
+	if units < 2 {
+		return ""
+	}
+
+	zeroEven, zeroOdd := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 && sample[i+1] != 0 {
+			zeroEven++
+		} else if sample[i] != 0 && sample[i+1] == 0 {
+			zeroOdd++
+		}
+	}
+
+	switch {
+	case float64(zeroOdd)/float64(units) >= wideThreshold:
+		return UTF16LE
+	case float64(zeroEven)/float64(units) >= wideThreshold:
+		return UTF16BE
+	default:
+		return ""
+	}
+}
+
+// mostlyUTF8 reports whether content that is not valid UTF-8 still holds multibyte UTF-8 characters, in which case
+// the invalid sequences are more likely corruption than a legacy single byte encoding.
+func mostlyUTF8(content []byte) bool {
+	valid, invalid := 0, 0
+	for len(content) > 0 {
+		r, size := utf8.DecodeRune(content)
+		if r == utf8.RuneError && size == 1 {
+			invalid++
+		} else if size > 1 {
+			valid++
+		}
+		content = content[size:]
+	}
+	return valid > invalid
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder) string {
+	units := make([]uint16, 0, len(content)/2)
+	for i := 0; i+1 < len(content); i += 2 {
+		units = append(units, order.Uint16(content[i:]))
+	}
+	text := string(utf16.Decode(units))
+	if len(content)%2 != 0 {
+		text += string(utf8.RuneError)
+	}
+	return text
+}
+
+func decodeUTF32(content []byte, order binary.ByteOrder) string {
+	sb := strings.Builder{}
+	sb.Grow(len(content) / 4)
+	for i := 0; i+3 < len(content); i += 4 {
+		r := rune(order.Uint32(content[i:]))
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		sb.WriteRune(r)
+	}
+	if len(content)%4 != 0 {
+		sb.WriteRune(utf8.RuneError)
+	}
+	return sb.String()
+}
+
+func decodeWindows1252(content []byte) string {
+	sb := strings.Builder{}
+	sb.Grow(len(content))
+	for _, b := range content {
+		switch {
+		case b < 0x80:
+			sb.WriteByte(b)
+		case b < 0xA0:
+			sb.WriteRune(windows1252[b-0x80])
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,108 @@
+package amalgam
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/charset"
+)
+
+const (
+	// generatedHeaderLines is the amount of lines at the start of a file searched for a generated code marker.
+	generatedHeaderLines = 20
+
+	// generatedSniffSize is the amount of bytes read from the start of a file to find its header lines.
+	generatedSniffSize = 16 * 1024
+
+	// goVendorManifest marks a Go vendor directory created by "go mod vendor".
+	goVendorManifest  = "modules.txt"
+	goVendorDirectory = "vendor"
+)
+
+var (
+	generatedMarkerRegex = regexp.MustCompile(`(?i)(code generated .*do not edit|@generated|<auto-?generated|this file (is|was) (automatically |auto-?)generated|autogenerated file)`)
+	commentPrefixes      = []string{"//", "#", "/*", "*", "<!--", "--", ";", "%", "'"}
+)
+
+// isLockFile reports whether a file name is a dependency manager lockfile.
+func isLockFile(file string) bool {
+	_, ok := lockFiles[file]
+	return ok
+}
+
+// isVendoredDirectory reports whether a directory holds vendored dependencies. A directory named vendor is only
+// considered vendored when it holds the manifest written by "go mod vendor".
+func isVendoredDirectory(absolutePath string, name string) (bool, string) {
+	if _, ok := vendoredDirectories[strings.ToLower(name)]; ok {
+		return true, name
+	}
+	if name == goVendorDirectory {
+		if _, err := os.Stat(filepath.Join(absolutePath, goVendorManifest)); err == nil {
+			return true, name + "/" + goVendorManifest
+		}
+	}
+	return false, ""
+}
+
+// isGenerated reports whether a file is generated, either from its name or from a marker comment in its header such
+// as the standard "// Code generated ... DO NOT EDIT." line. The header is converted to UTF-8 first, so markers in
+// UTF-16 and UTF-32 files are found too.
+func isGenerated(absolutePath string, file string) (generated bool, detail string, returnErr error) {
+	if generated, suffix := isGeneratedName(file); generated {
+		return true, suffix, nil
+	}
+
+	handle, err := os.Open(absolutePath)
+	if err != nil {
+		return false, "", fmt.Errorf("error opening file %s (%w)", absolutePath, err)
+	}
+	defer func() {
+		if err := handle.Close(); err != nil && returnErr == nil {
+			returnErr = fmt.Errorf("error closing file %s (%w)", absolutePath, err)
+		}
+	}()
+
+	head := make([]byte, generatedSniffSize)
+	n, err := io.ReadFull(handle, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, "", fmt.Errorf("error reading file %s (%w)", absolutePath, err)
+	}
+	text, _, _ := charset.ToUTF8(head[:n])
+
+	lines := strings.SplitN(text, "\n", generatedHeaderLines+1)
+	for lineNumber := 1; lineNumber <= generatedHeaderLines && lineNumber <= len(lines); lineNumber++ {
+		line := strings.TrimSpace(lines[lineNumber-1])
+		if !hasCommentPrefix(line) {
+			continue
+		}
+		if marker := generatedMarkerRegex.FindString(line); marker != "" {
+			return true, fmt.Sprintf("line %d: %s", lineNumber, line), nil
+		}
+	}
+
+	return false, "", nil
+}
+
+// isGeneratedName reports whether the name of a file marks it as generated.
+func isGeneratedName(file string) (bool, string) {
+	lowerFile := strings.ToLower(file)
+	for suffix := range generatedSuffix {
+		if strings.HasSuffix(lowerFile, strings.ToLower(suffix)) {
+			return true, suffix
+		}
+	}
+	return false, ""
+}
+
+func hasCommentPrefix(line string) bool {
+	for _, prefix := range commentPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+package amalgam
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/charset"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/language"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	// binarySniffSize is the amount of bytes searched for a NUL byte when deciding if a file is binary.
+	binarySniffSize = 8000
+)
+
+// The rules that decide whether a path is part of the amalgam.
+const (
+	RuleDisallowedPath   = "disallowedPath"
+	RuleRequestExclude   = "requestExclude"
+	RuleIgnoreFile       = "ignoreFile"
+	RuleDisallowedSuffix = "disallowedSuffix"
+	RuleTestFile         = "testFile"
+	RuleRequestInclude   = "notInRequestInclude"
+	RuleNotAllowed       = "notAllowed"
+	RuleSizeLimit        = "sizeLimit"
+	RuleBinary           = "binary"
+	RuleGenerated        = "generated"
+	RuleVendored         = "vendored"
+	RuleLockFile         = "lockFile"
+	RuleAllowedFile      = "allowedExactFile"
+	RuleAllowedSuffix    = "allowedSuffix"
+	RuleAllowedLanguage  = "allowedLanguage"
+	RuleDirectory        = "directory"
+)
+
+// decision is the outcome of the filter rules for a single path.
+type decision struct {
+	included bool
+	rule     string
+	detail   string
+}
+
+// filterOptions are the request-time options with their defaults resolved.
+type filterOptions struct {
+	include          []string
+	exclude          []string
+	includeTests     bool
+	excludeGenerated bool
+	excludeVendored  bool
+	excludeLockFiles bool
+}
+
+func newFilterOptions(options *models.AmalgamOptions) *filterOptions {
+	return &filterOptions{
+		include:          options.Include,
+		exclude:          options.Exclude,
+		includeTests:     valueOrDefault(options.IncludeTests, false),
+		excludeGenerated: valueOrDefault(options.ExcludeGenerated, true),
+		excludeVendored:  valueOrDefault(options.ExcludeVendored, true),
+		excludeLockFiles: valueOrDefault(options.ExcludeLockFiles, true),
+	}
+}
+
+func valueOrDefault(value *bool, defaultValue bool) bool {
+	if value == nil {
+		return defaultValue
+	}
+	return *value
+}
+
+// visitFunc is called by walk for every file and every directory below the root. The path is relative to the root
+// and slash separated.
+type visitFunc func(relativePath string, info os.FileInfo, d *decision) error
+
+// walk traverses root and decides for every path whether it is part of the amalgam. Excluded directories are visited
+// but not descended into.
+func walk(ctx context.Context, root string, filter *filterOptions, visit visitFunc) error {
+	ignorePatterns := make([]*ignorePattern, 0)
+
+	return filepath.Walk(root, func(absolutePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(root, absolutePath)
+		if err != nil {
+			return fmt.Errorf("error getting relative path for file %s and root %s (%w)", absolutePath, root, err)
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		d := decide(absolutePath, relativePath, info, filter, ignorePatterns)
+		if relativePath != "." {
+			if err := visit(relativePath, info, d); err != nil {
+				return err
+			}
+		}
+		if info.IsDir() {
+			if !d.included {
+				return filepath.SkipDir
+			}
+			dirPatterns, err := loadIgnorePatterns(root, relativePath)
+			if err != nil {
+				return err
+			}
+			ignorePatterns = append(ignorePatterns, dirPatterns...)
+		}
+
+		return nil
+	})
+}
+
+func decide(absolutePath string, relativePath string, info os.FileInfo, filter *filterOptions, ignorePatterns []*ignorePattern) *decision {
+	if d := decidePath(absolutePath, relativePath, info.IsDir(), filter, ignorePatterns); d != nil {
+		return d
+	}
+
+	file := path.Base(relativePath)
+	d := decideAllowed(absolutePath, file)
+	if !d.included {
+		return d
+	}
+
+	if maxFileSize > 0 && info.Size() > maxFileSize {
+		return &decision{rule: RuleSizeLimit, detail: fmt.Sprintf("%d > %d bytes", info.Size(), maxFileSize)}
+	}
+
+	// A file that cannot be sniffed is kept, so the error surfaces when the amalgam reads it instead of the file being
+	// excluded under a rule that does not apply to it.
+	binary, err := isBinary(absolutePath)
+	if err != nil {
+		logger.Warnf("Failed to check if %s is binary (%s).", relativePath, err.Error())
+	}
+	if binary {
+		return &decision{rule: RuleBinary}
+	}
+
+	if filter.excludeGenerated {
+		generated, detail, err := isGenerated(absolutePath, file)
+		if err != nil {
+			logger.Warnf("Failed to check if %s is generated (%s).", relativePath, err.Error())
+		}
+		if generated {
+			return &decision{rule: RuleGenerated, detail: detail}
+		}
+	}
+
+	return d
+}
+
+// decidePath applies the rules that only need the path. It returns nil for a file that passes them, in which case the
+// allow rules and the rules that read the file decide.
+func decidePath(absolutePath string, relativePath string, isDir bool, filter *filterOptions, ignorePatterns []*ignorePattern) *decision {
+	if relativePath == "." {
+		return &decision{included: true, rule: RuleDirectory}
+	}
+
+	for _, pathPart := range strings.Split(relativePath, "/") {
+		if _, hasPathPart := disallowedExactPaths[strings.ToLower(pathPart)]; hasPathPart {
+			return &decision{rule: RuleDisallowedPath, detail: pathPart}
+		}
+	}
+
+	for _, exclude := range filter.exclude {
+		if matchGlob(exclude, relativePath) {
+			return &decision{rule: RuleRequestExclude, detail: exclude}
+		}
+	}
+
+	var ignoredBy *ignorePattern
+	for _, pattern := range ignorePatterns {
+		if pattern.matches(relativePath, isDir) {
+			if pattern.negate {
+				ignoredBy = nil
+			} else {
+				ignoredBy = pattern
+			}
+		}
+	}
+	if ignoredBy != nil {
+		return &decision{rule: RuleIgnoreFile, detail: ignoredBy.String()}
+	}
+
+	file := path.Base(relativePath)
+	if isDir {
+		if filter.excludeVendored {
+			if vendored, detail := isVendoredDirectory(absolutePath, file); vendored {
+				return &decision{rule: RuleVendored, detail: detail}
+			}
+		}
+		return &decision{included: true, rule: RuleDirectory}
+	}
+
+	for disallowed := range disallowedSuffix {
+		if strings.HasSuffix(strings.ToLower(file), strings.ToLower(disallowed)) {
+			return &decision{rule: RuleDisallowedSuffix, detail: disallowed}
+		}
+	}
+
+	if !filter.includeTests {
+		for suffix := range testSuffix {
+			if strings.HasSuffix(strings.ToLower(file), strings.ToLower(suffix)) {
+				return &decision{rule: RuleTestFile, detail: suffix}
+			}
+		}
+	}
+
+	if len(filter.include) > 0 {
+		included := false
+		for _, include := range filter.include {
+			if matchGlob(include, relativePath) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return &decision{rule: RuleRequestInclude}
+		}
+	}
+
+	if filter.excludeLockFiles && isLockFile(file) {
+		return &decision{rule: RuleLockFile, detail: file}
+	}
+
+	return nil
+}
+
+func decideAllowed(absolutePath string, file string) *decision {
+	if _, ok := allowedExactFiles[file]; ok {
+		return &decision{included: true, rule: RuleAllowedFile, detail: file}
+	}
+
+	ext := filepath.Ext(file)
+	if _, ok := allowedSuffix[ext]; ok {
+		return &decision{included: true, rule: RuleAllowedSuffix, detail: ext}
+	}
+
+	if len(allowedLanguages) > 0 {
+		// A file whose language cannot be detected is treated as a file of an unknown language, so a single unreadable
+		// file does not stop the walk.
+		lang, err := language.DetectFile(absolutePath)
+		if err != nil {
+			logger.Debugf("Failed to detect the language of %s (%s).", absolutePath, err.Error())
+			lang = ""
+		}
+		if language.Matches(lang, allowedLanguages) {
+			return &decision{included: true, rule: RuleAllowedLanguage, detail: lang}
+		}
+	}
+
+	return &decision{rule: RuleNotAllowed}
+}
+
+// isBinary reports whether the start of a file contains a NUL byte. Text in UTF-16 or UTF-32 is not binary even
+// though it is full of NUL bytes.
+func isBinary(absolutePath string) (binary bool, returnErr error) {
+	file, err := os.Open(absolutePath)
+	if err != nil {
+		return false, fmt.Errorf("error opening file %s (%w)", absolutePath, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil && returnErr == nil {
+			returnErr = fmt.Errorf("error closing file %s (%w)", absolutePath, err)
+		}
+	}()
+
+	head := make([]byte, binarySniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, fmt.Errorf("error reading file %s (%w)", absolutePath, err)
+	}
+	if charset.IsWide(charset.Detect(head[:n])) {
+		return false, nil
+	}
+	return bytes.IndexByte(head[:n], 0) != -1, nil
+}
+
+// Directories returns the directories of root that can hold files of an amalgam, relative to root and slash
+// separated. The root itself is included as ".". Only the rules that apply whatever the request-time options are, the
+// disallowed paths and the ignore files, exclude a directory, and files are neither opened nor decided on.
+func Directories(ctx context.Context, root string) ([]string, error) {
+	directories := []string{"."}
+	filter := &filterOptions{}
+	ignorePatterns := make([]*ignorePattern, 0)
+
+	err := filepath.WalkDir(root, func(absolutePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(root, absolutePath)
+		if err != nil {
+			return fmt.Errorf("error getting relative path for directory %s and root %s (%w)", absolutePath, root, err)
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if relativePath != "." {
+			if d := decidePath(absolutePath, relativePath, true, filter, ignorePatterns); !d.included {
+				return filepath.SkipDir
+			}
+			directories = append(directories, relativePath)
+		}
+		dirPatterns, err := loadIgnorePatterns(root, relativePath)
+		if err != nil {
+			return err
+		}
+		ignorePatterns = append(ignorePatterns, dirPatterns...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return directories, nil
+}
+
+// Relevant reports whether a change to a path can affect the amalgam built with the default options. The parent
+// directories of the path are assumed to be walked. A path that no longer exists is judged by its name alone.
+func Relevant(root string, relativePath string) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	if slices.Contains(ignoreFiles, path.Base(relativePath)) {
+		return true
+	}
+
+	ignorePatterns := make([]*ignorePattern, 0)
+	for directory := path.Dir(relativePath); ; directory = path.Dir(directory) {
+		dirPatterns, err := loadIgnorePatterns(root, directory)
+		if err != nil {
+			return true
+		}
+		ignorePatterns = append(dirPatterns, ignorePatterns...)
+		if directory == "." {
+			break
+		}
+	}
+
+	filter := newFilterOptions(&models.AmalgamOptions{})
+	absolutePath := filepath.Join(root, filepath.FromSlash(relativePath))
+	info, err := os.Stat(absolutePath)
+	if err != nil {
+		if d := decidePath(absolutePath, relativePath, false, filter, ignorePatterns); d != nil {
+			return d.included
+		}
+		file := path.Base(relativePath)
+		_, exactFile := allowedExactFiles[file]
+		_, suffix := allowedSuffix[filepath.Ext(file)]
+		return exactFile || suffix || language.Matches(language.FromPath(file), allowedLanguages)
+	}
+
+	return decide(absolutePath, relativePath, info, filter, ignorePatterns).included
+}
@@ -0,0 +1,115 @@
+package amalgam
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	globStarStar = "**"
+)
+
+// validateGlob checks that every segment of a glob pattern is well-formed.
+func validateGlob(pattern string) error {
+	if strings.TrimSpace(pattern) == "" {
+		return fmt.Errorf("the pattern is empty")
+	}
+	for _, segment := range globSegments(pattern) {
+		if segment == globStarStar {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s (%w)", pattern, err)
+		}
+	}
+	return nil
+}
+
+// globSegments splits a glob pattern into its segments. Consecutive "**" segments are collapsed into one, since they
+// match the same paths and every extra one multiplies the work of the match.
+func globSegments(pattern string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == globStarStar && len(segments) > 0 && segments[len(segments)-1] == globStarStar {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// matchGlob reports whether a slash separated relative path matches a glob pattern. A pattern without a slash matches
+// the name of any path element, and a pattern with a slash is anchored at the root. A "**" segment matches zero or
+// more path elements. The pattern also matches every path under a directory it matches, so "pkg/db" and "pkg/db/**"
+// are equivalent.
+func matchGlob(pattern string, relativePath string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+	pathParts := strings.Split(relativePath, "/")
+
+	if !strings.Contains(pattern, "/") {
+		for _, part := range pathParts {
+			if matched, _ := path.Match(pattern, part); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	patternParts := globSegments(pattern)
+	for end := len(pathParts); end > 0; end-- {
+		if matchSegments(patternParts, pathParts[:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments reports whether the elements of a path match the segments of a pattern.
+func matchSegments(patternParts []string, pathParts []string) bool {
+	matcher := &segmentMatcher{
+		patternParts: patternParts,
+		pathParts:    pathParts,
+		results:      make(map[[2]int]bool),
+	}
+	return matcher.match(0, 0)
+}
+
+// segmentMatcher matches the segments of a pattern against the elements of a path. The results are memoized on the
+// positions in both, so a pattern with many "**" segments is matched in polynomial time.
+type segmentMatcher struct {
+	patternParts []string
+	pathParts    []string
+	results      map[[2]int]bool
+}
+
+func (m *segmentMatcher) match(patternIndex int, pathIndex int) bool {
+	key := [2]int{patternIndex, pathIndex}
+	if result, found := m.results[key]; found {
+		return result
+	}
+	result := m.matchUncached(patternIndex, pathIndex)
+	m.results[key] = result
+	return result
+}
+
+func (m *segmentMatcher) matchUncached(patternIndex int, pathIndex int) bool {
+	if patternIndex == len(m.patternParts) {
+		return pathIndex == len(m.pathParts)
+	}
+	if m.patternParts[patternIndex] == globStarStar {
+		for skip := pathIndex; skip <= len(m.pathParts); skip++ {
+			if m.match(patternIndex+1, skip) {
+				return true
+			}
+		}
+		return false
+	}
+	if pathIndex == len(m.pathParts) {
+		return false
+	}
+	if matched, _ := path.Match(m.patternParts[patternIndex], m.pathParts[pathIndex]); !matched {
+		return false
+	}
+	return m.match(patternIndex+1, pathIndex+1)
+}
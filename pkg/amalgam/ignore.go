@@ -0,0 +1,118 @@
+package amalgam
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+// ignorePattern is a single line of an ignore file such as .gitignore.
+type ignorePattern struct {
+	source   string
+	line     int
+	text     string
+	glob     string
+	base     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// String returns the location and the text of the pattern, for example ".gitignore:3 build/".
+func (p *ignorePattern) String() string {
+	return fmt.Sprintf("%s:%d %s", p.source, p.line, p.text)
+}
+
+// matches reports whether a slash separated path relative to the project root matches the pattern.
+func (p *ignorePattern) matches(relativePath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "." {
+		if !strings.HasPrefix(relativePath, p.base+"/") {
+			return false
+		}
+		relativePath = strings.TrimPrefix(relativePath, p.base+"/")
+	}
+	if !p.anchored {
+		matched, _ := path.Match(p.glob, path.Base(relativePath))
+		return matched
+	}
+	return matchSegments(globSegments(p.glob), strings.Split(relativePath, "/"))
+}
+
+// loadIgnorePatterns reads the configured ignore files in a directory. The directory is relative to root and slash
+// separated.
+func loadIgnorePatterns(root string, directory string) ([]*ignorePattern, error) {
+	patterns := make([]*ignorePattern, 0)
+	for _, ignoreFile := range ignoreFiles {
+		filePatterns, err := parseIgnoreFile(root, directory, ignoreFile)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, filePatterns...)
+	}
+	return patterns, nil
+}
+
+func parseIgnoreFile(root string, directory string, name string) (patterns []*ignorePattern, returnErr error) {
+	source := path.Join(directory, name)
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(source)))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening ignore file %s (%w)", source, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close ignore file %s (%w)", source, err))
+		}
+	}()
+
+	lineNumber := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := &ignorePattern{
+			source: source,
+			line:   lineNumber,
+			text:   line,
+			base:   directory,
+		}
+		glob := line
+		if strings.HasPrefix(glob, "!") {
+			pattern.negate = true
+			glob = glob[1:]
+		}
+		glob = strings.TrimPrefix(glob, "\\")
+		if strings.HasSuffix(glob, "/") {
+			pattern.dirOnly = true
+			glob = strings.TrimSuffix(glob, "/")
+		}
+		pattern.anchored = strings.Contains(glob, "/")
+		pattern.glob = strings.TrimPrefix(glob, "/")
+		if err := validateGlob(pattern.glob); err != nil {
+			logger.Warnf("Skipping invalid ignore pattern %s (%s).", pattern.String(), err.Error())
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ignore file %s (%w)", source, err)
+	}
+
+	return patterns, nil
+}
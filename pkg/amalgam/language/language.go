@@ -0,0 +1,191 @@
+package language
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// sniffSize is the amount of bytes read from the start and the end of a file when looking for a shebang or modeline.
+	sniffSize = 4096
+
+	// modelineLines is the amount of lines at the start and the end of a file that are searched for a modeline.
+	modelineLines = 5
+)
+
+var (
+	vimModelineRegex   = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d+)?:.*?\b(?:ft|filetype|syntax)=([\w+#-]+)`)
+	emacsModelineRegex = regexp.MustCompile(`-\*-\s*(?:.*?[Mm]ode:\s*([\w+#-]+)|([\w+#-]+))\s*(?:;.*?)?-\*-`)
+)
+
+// FromPath returns the language of a file based on its name or extension. An empty string is returned if the
+// language cannot be determined from the path alone.
+func FromPath(path string) string {
+	name := filepath.Base(path)
+	if language, ok := filenames[name]; ok {
+		return language
+	}
+	if language, ok := filenames[strings.ToLower(name)]; ok {
+		return language
+	}
+	for prefix, language := range filenamePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return language
+		}
+	}
+	if language, ok := extensions[strings.ToLower(filepath.Ext(name))]; ok {
+		return language
+	}
+	return ""
+}
+
+// FromContent returns the language of a file based on its shebang or an editor modeline. An empty string is
+// returned if the content has neither. Only the start and the end of the content are inspected.
+func FromContent(content []byte) string {
+	if len(content) > sniffSize*2 {
+		content = joinHeadAndTail(content[:sniffSize], content[len(content)-sniffSize:])
+	}
+
+	lines := splitLines(content)
+	if len(lines) == 0 {
+		return ""
+	}
+
+	if language := fromShebang(lines[0]); language != "" {
+		return language
+	}
+
+	candidates := lines
+	if len(lines) > modelineLines*2 {
+		candidates = append(lines[:modelineLines:modelineLines], lines[len(lines)-modelineLines:]...)
+	}
+	for _, line := range candidates {
+		if language := fromModeline(line); language != "" {
+			return language
+		}
+	}
+
+	return ""
+}
+
+// Detect returns the language of a file given its path and content. The path takes precedence over the content.
+func Detect(path string, content []byte) string {
+	if language := FromPath(path); language != "" {
+		return language
+	}
+	return FromContent(content)
+}
+
+// DetectFile returns the language of the file at the given path. Only the start and the end of the file are read
+// when the path is not conclusive.
+func DetectFile(path string) (returnLanguage string, returnErr error) {
+	if language := FromPath(path); language != "" {
+		return language, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file %s (%w)", path, err)
+	}
+	defer func() {
+		if err := file.Close(); err != nil && returnErr == nil {
+			returnErr = fmt.Errorf("error closing file %s (%w)", path, err)
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error getting file info for %s (%w)", path, err)
+	}
+
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("error reading file %s (%w)", path, err)
+	}
+	content := head[:n]
+
+	if info.Size() > sniffSize {
+		tailOffset := max(info.Size()-sniffSize, sniffSize)
+		tail := make([]byte, info.Size()-tailOffset)
+		n, err = file.ReadAt(tail, tailOffset)
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("error reading file %s (%w)", path, err)
+		}
+		content = joinHeadAndTail(content, tail[:n])
+	}
+
+	return FromContent(content), nil
+}
+
+// Matches reports whether a language is in a set of lower-cased language names.
+func Matches(language string, languages map[string]struct{}) bool {
+	if language == "" {
+		return false
+	}
+	_, ok := languages[strings.ToLower(language)]
+	return ok
+}
+
+func fromShebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+				continue
+			}
+			interpreter = filepath.Base(field)
+			break
+		}
+	}
+
+	interpreter = strings.TrimRight(interpreter, "0123456789.")
+	return interpreters[interpreter]
+}
+
+func fromModeline(line string) string {
+	var name string
+	if match := vimModelineRegex.FindStringSubmatch(line); match != nil {
+		name = match[1]
+	} else if match := emacsModelineRegex.FindStringSubmatch(line); match != nil {
+		name = match[1]
+		if name == "" {
+			name = match[2]
+		}
+	}
+	return modelineNames[strings.ToLower(name)]
+}
+
+// joinHeadAndTail separates the head from the tail with a newline so that a partial last line of the head does not
+// merge with a partial first line of the tail.
+func joinHeadAndTail(head []byte, tail []byte) []byte {
+	joined := make([]byte, 0, len(head)+len(tail)+1)
+	joined = append(joined, head...)
+	joined = append(joined, '\n')
+	return append(joined, tail...)
+}
+
+func splitLines(content []byte) []string {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, sniffSize), len(content)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
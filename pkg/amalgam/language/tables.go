@@ -0,0 +1,200 @@
+package language
+
+const (
+	Batch           = "Batch"
+	C               = "C"
+	CMake           = "CMake"
+	CPP             = "C++"
+	CSharp          = "C#"
+	CSS             = "CSS"
+	Dart            = "Dart"
+	Dockerfile      = "Dockerfile"
+	Go              = "Go"
+	Groovy          = "Groovy"
+	HCL             = "HCL"
+	HTML            = "HTML"
+	Java            = "Java"
+	JavaScript      = "JavaScript"
+	JSON            = "JSON"
+	Kotlin          = "Kotlin"
+	Lua             = "Lua"
+	Makefile        = "Makefile"
+	Markdown        = "Markdown"
+	Notebook        = "Jupyter Notebook"
+	ObjectiveC      = "Objective-C"
+	Perl            = "Perl"
+	PHP             = "PHP"
+	PowerShell      = "PowerShell"
+	ProtocolBuffers = "Protocol Buffers"
+	Python          = "Python"
+	R               = "R"
+	Ruby            = "Ruby"
+	Rust            = "Rust"
+	Scala           = "Scala"
+	SCSS            = "SCSS"
+	Shell           = "Shell"
+	SQL             = "SQL"
+	Starlark        = "Starlark"
+	Swift           = "Swift"
+	TOML            = "TOML"
+	TypeScript      = "TypeScript"
+	XML             = "XML"
+	YAML            = "YAML"
+)
+
+// extensions maps lower-cased file extensions to their language.
+var extensions = map[string]string{
+	".bash":   Shell,
+	".bat":    Batch,
+	".bzl":    Starlark,
+	".c":      C,
+	".cc":     CPP,
+	".cjs":    JavaScript,
+	".cmake":  CMake,
+	".cmd":    Batch,
+	".cpp":    CPP,
+	".cs":     CSharp,
+	".css":    CSS,
+	".cxx":    CPP,
+	".dart":   Dart,
+	".go":     Go,
+	".gradle": Groovy,
+	".groovy": Groovy,
+	".h":      C,
+	".hcl":    HCL,
+	".hh":     CPP,
+	".hpp":    CPP,
+	".htm":    HTML,
+	".html":   HTML,
+	".ipynb":  Notebook,
+	".java":   Java,
+	".js":     JavaScript,
+	".json":   JSON,
+	".jsx":    JavaScript,
+	".kt":     Kotlin,
+	".kts":    Kotlin,
+	".lua":    Lua,
+	".m":      ObjectiveC,
+	".md":     Markdown,
+	".mjs":    JavaScript,
+	".mk":     Makefile,
+	".mm":     ObjectiveC,
+	".php":    PHP,
+	".pl":     Perl,
+	".pm":     Perl,
+	".proto":  ProtocolBuffers,
+	".ps1":    PowerShell,
+	".py":     Python,
+	".r":      R,
+	".rb":     Ruby,
+	".rs":     Rust,
+	".scala":  Scala,
+	".scss":   SCSS,
+	".sh":     Shell,
+	".sql":    SQL,
+	".star":   Starlark,
+	".swift":  Swift,
+	".tf":     HCL,
+	".toml":   TOML,
+	".ts":     TypeScript,
+	".tsx":    TypeScript,
+	".xml":    XML,
+	".yaml":   YAML,
+	".yml":    YAML,
+	".zsh":    Shell,
+}
+
+// filenames maps well-known file names to their language.
+var filenames = map[string]string{
+	".bash_profile":  Shell,
+	".bashrc":        Shell,
+	".profile":       Shell,
+	".zshrc":         Shell,
+	"BUCK":           Starlark,
+	"BUILD":          Starlark,
+	"BUILD.bazel":    Starlark,
+	"CMakeLists.txt": CMake,
+	"Containerfile":  Dockerfile,
+	"Dockerfile":     Dockerfile,
+	"GNUmakefile":    Makefile,
+	"Gemfile":        Ruby,
+	"Jenkinsfile":    Groovy,
+	"Makefile":       Makefile,
+	"Rakefile":       Ruby,
+	"Tiltfile":       Starlark,
+	"WORKSPACE":      Starlark,
+	"makefile":       Makefile,
+}
+
+// filenamePrefixes maps file name prefixes to their language for names such as Dockerfile.dev or Jenkinsfile.release.
+var filenamePrefixes = map[string]string{
+	"Dockerfile.":  Dockerfile,
+	"Jenkinsfile.": Groovy,
+	"Makefile.":    Makefile,
+}
+
+// interpreters maps shebang interpreters, without any version suffix, to their language.
+var interpreters = map[string]string{
+	"ash":     Shell,
+	"bash":    Shell,
+	"bun":     JavaScript,
+	"dash":    Shell,
+	"deno":    TypeScript,
+	"groovy":  Groovy,
+	"ksh":     Shell,
+	"lua":     Lua,
+	"make":    Makefile,
+	"node":    JavaScript,
+	"nodejs":  JavaScript,
+	"perl":    Perl,
+	"php":     PHP,
+	"pwsh":    PowerShell,
+	"python":  Python,
+	"Rscript": R,
+	"ruby":    Ruby,
+	"sh":      Shell,
+	"ts-node": TypeScript,
+	"tsx":     TypeScript,
+	"zsh":     Shell,
+}
+
+// modelineNames maps lower-cased vim file types and emacs modes to their language.
+var modelineNames = map[string]string{
+	"bash":         Shell,
+	"bzl":          Starlark,
+	"c":            C,
+	"c++":          CPP,
+	"cmake":        CMake,
+	"cpp":          CPP,
+	"cs":           CSharp,
+	"css":          CSS,
+	"dockerfile":   Dockerfile,
+	"go":           Go,
+	"groovy":       Groovy,
+	"html":         HTML,
+	"java":         Java,
+	"javascript":   JavaScript,
+	"js":           JavaScript,
+	"json":         JSON,
+	"lua":          Lua,
+	"make":         Makefile,
+	"makefile":     Makefile,
+	"markdown":     Markdown,
+	"perl":         Perl,
+	"php":          PHP,
+	"ps1":          PowerShell,
+	"python":       Python,
+	"r":            R,
+	"ruby":         Ruby,
+	"rust":         Rust,
+	"sh":           Shell,
+	"shell":        Shell,
+	"shell-script": Shell,
+	"sql":          SQL,
+	"starlark":     Starlark,
+	"toml":         TOML,
+	"typescript":   TypeScript,
+	"xml":          XML,
+	"yaml":         YAML,
+	"zsh":          Shell,
+}
@@ -0,0 +1,142 @@
+package notebook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	cellTypeCode     = "code"
+	cellTypeMarkdown = "markdown"
+	cellTypeRaw      = "raw"
+
+	outputTypeStream        = "stream"
+	outputTypeExecuteResult = "execute_result"
+	outputTypeDisplayData   = "display_data"
+	outputTypeError         = "error"
+
+	mimeTextPlain = "text/plain"
+)
+
+// Options controls how a notebook is rendered.
+type Options struct {
+	// MaxOutputLength is the maximum amount of characters kept from the text outputs of a code cell. Outputs are
+	// dropped when it is zero. Binary outputs such as images are always dropped.
+	MaxOutputLength int
+}
+
+// multilineString is a notebook string, which is stored either as a single string or as a list of lines.
+type multilineString string
+
+func (m *multilineString) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*m = multilineString(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*m = multilineString(text)
+	return nil
+}
+
+type output struct {
+	OutputType string                     `json:"output_type"`
+	Text       multilineString            `json:"text"`
+	Data       map[string]json.RawMessage `json:"data"`
+	EName      string                     `json:"ename"`
+	EValue     string                     `json:"evalue"`
+}
+
+type cell struct {
+	CellType string          `json:"cell_type"`
+	Source   multilineString `json:"source"`
+	Outputs  []output        `json:"outputs"`
+}
+
+type notebook struct {
+	NBFormat int    `json:"nbformat"`
+	Cells    []cell `json:"cells"`
+	Metadata struct {
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+// Extract renders the cells of a Jupyter notebook in order as markdown and fenced code sections.
+func Extract(content []byte, options *Options) (string, error) {
+	nb := &notebook{}
+	if err := json.Unmarshal(content, nb); err != nil {
+		return "", fmt.Errorf("error parsing notebook (%w)", err)
+	}
+	if nb.NBFormat < 4 {
+		return "", fmt.Errorf("unsupported notebook format version %d", nb.NBFormat)
+	}
+
+	kernelLanguage := nb.Metadata.LanguageInfo.Name
+	if kernelLanguage == "" {
+		kernelLanguage = nb.Metadata.KernelSpec.Language
+	}
+
+	sb := strings.Builder{}
+	for i, c := range nb.Cells {
+		source := strings.TrimSpace(string(c.Source))
+		if source == "" {
+			continue
+		}
+
+		switch c.CellType {
+		case cellTypeMarkdown:
+			sb.WriteString(fmt.Sprintf("## Cell %d (markdown)\n\n%s\n\n", i+1, source))
+		case cellTypeCode:
+			sb.WriteString(fmt.Sprintf("## Cell %d (code)\n\n```%s\n%s\n```\n\n", i+1, kernelLanguage, source))
+			if outputText := renderOutputs(c.Outputs, options.MaxOutputLength); outputText != "" {
+				sb.WriteString(fmt.Sprintf("Output:\n\n```\n%s\n```\n\n", outputText))
+			}
+		case cellTypeRaw:
+			sb.WriteString(fmt.Sprintf("## Cell %d (raw)\n\n%s\n\n", i+1, source))
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// renderOutputs joins the text outputs of a code cell and truncates them to the maximum length.
+func renderOutputs(outputs []output, maxLength int) string {
+	if maxLength <= 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(outputs))
+	for _, o := range outputs {
+		switch o.OutputType {
+		case outputTypeStream:
+			parts = append(parts, strings.TrimRight(string(o.Text), "\n"))
+		case outputTypeExecuteResult, outputTypeDisplayData:
+			rawText, ok := o.Data[mimeTextPlain]
+			if !ok {
+				continue
+			}
+			var text multilineString
+			if err := json.Unmarshal(rawText, &text); err != nil {
+				continue
+			}
+			parts = append(parts, strings.TrimRight(string(text), "\n"))
+		case outputTypeError:
+			parts = append(parts, fmt.Sprintf("%s: %s", o.EName, o.EValue))
+		}
+	}
+
+	joined := strings.TrimSpace(strings.Join(parts, "\n"))
+	if runes := []rune(joined); len(runes) > maxLength {
+		joined = string(runes[:maxLength]) + "\n... (output truncated)"
+	}
+	return joined
+}
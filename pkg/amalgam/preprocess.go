@@ -0,0 +1,29 @@
+package amalgam
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/notebook"
+)
+
+// preprocessor converts the raw content of a file to the text that is placed in the amalgam.
+type preprocessor func(content []byte) (string, error)
+
+// preprocessors maps lower-cased file extensions to their preprocessor. Files without a preprocessor are placed in the
+// amalgam as they are.
+var preprocessors = make(map[string]preprocessor)
+
+func registerPreprocessors() {
+	notebookOptions := &notebook.Options{
+		MaxOutputLength: notebookMaxOutputLength,
+	}
+	preprocessors[".ipynb"] = func(content []byte) (string, error) {
+		return notebook.Extract(content, notebookOptions)
+	}
+}
+
+func preprocessorFor(file string) (preprocessor, bool) {
+	p, ok := preprocessors[strings.ToLower(filepath.Ext(file))]
+	return p, ok
+}
@@ -1,9 +1,22 @@
 package api
 
 const (
-	PathApiRoot   = "/api/v1"
-	PathProjects  = PathApiRoot + "/projects"
-	PathProjectId = PathProjects + "/{projectId}"
-	PathAmalgam   = PathProjectId + "/amalgam"
-	PathChat      = PathApiRoot + "/chat"
+	PathApiRoot         = "/api/v1"
+	PathProjects        = PathApiRoot + "/projects"
+	PathProjectId       = PathProjects + "/{projectId}"
+	PathProjectSettings = PathProjectId + "/settings"
+	PathProjectEvents   = PathProjectId + "/events"
+	PathProjectSearch   = PathProjectId + "/search"
+	PathProjectPrompt   = PathProjectId + "/prompt"
+	PathProjectPatches  = PathProjectId + "/patches"
+	PathPatchesDryRun   = PathProjectPatches + "/dry-run"
+	PathPatchSetId      = PathProjectPatches + "/{patchSetId}"
+	PathPatchSetRevert  = PathPatchSetId + "/revert"
+	PathAmalgam         = PathProjectId + "/amalgam"
+	PathAmalgamExplain  = PathAmalgam + "/explain"
+	PathChat            = PathApiRoot + "/chat"
+	PathModels          = PathApiRoot + "/models"
+	PathUsage           = PathApiRoot + "/usage"
+	PathTemplates       = PathApiRoot + "/templates"
+	PathTemplateId      = PathTemplates + "/{templateId}"
 )
@@ -1,6 +1,84 @@
 package config
 
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderFake      = "fake"
+)
+
 type Config struct {
-	ApiKey       string `config_format:"snake" validate:"required"`
+	Provider     string `config_format:"snake" config_default:"openai" validate:"required,oneof=openai anthropic fake"`
+	ApiKey       string `config_format:"snake"`
 	ModelVersion string `config_format:"snake" config_default:"gpt-4o" validate:"required"`
+
+	// OpenaiApiKey and AnthropicApiKey enable a provider next to the default one. The default provider falls back to
+	// ApiKey when its own key is not set.
+	OpenaiApiKey    string `config_format:"snake"`
+	AnthropicApiKey string `config_format:"snake"`
+
+	// RetryMaxAttempts is the amount of attempts to reach a provider that answers with a rate limit or a server error.
+	// The delay between attempts doubles from RetryBaseDelayMs up to RetryMaxDelayMs, unless the provider asks for a
+	// specific delay, which is also cut to RetryMaxDelayMs.
+	RetryMaxAttempts int `config_format:"snake" config_default:"3"`
+	RetryBaseDelayMs int `config_format:"snake" config_default:"500"`
+	RetryMaxDelayMs  int `config_format:"snake" config_default:"20000"`
+
+	// AgentMaxSteps limits the replies of the model in agent mode. The last one cannot call tools anymore.
+	AgentMaxSteps int `config_format:"snake" config_default:"12" validate:"gte=1"`
+
+	// Embedder computes the vectors of the retrieval index, either with the OpenAI embeddings API and EmbeddingModel, or
+	// with a local hash of the words. The hash is used when the OpenAI API has no key, unless OpenAI is the provider.
+	Embedder       string `config_format:"snake" config_default:"openai" validate:"required,oneof=openai hash"`
+	EmbeddingModel string `config_format:"snake" config_default:"text-embedding-3-small" validate:"required"`
+
+	// RetrievalTopK is the amount of chunks added to a chat in retrieval mode, and RetrievalChunkLines the length of
+	// the chunks the files are split in.
+	RetrievalTopK       int `config_format:"snake" config_default:"8" validate:"gte=1"`
+	RetrievalChunkLines int `config_format:"snake" config_default:"60" validate:"gte=1"`
+
+	// ModelsFile lists the models that can be selected per chat request and their context window sizes.
+	ModelsFile string `config_format:"snake" config_default:"models.json" validate:"required"`
+
+	// OpenaiBaseUrl points the OpenAI provider at another server that speaks the OpenAI API, such as llama.cpp,
+	// Ollama or vLLM. It includes the version prefix, for example http://localhost:11434/v1.
+	OpenaiBaseUrl string `config_format:"snake" config_default:"https://api.openai.com/v1" validate:"required"`
+
+	// AnthropicBaseUrl points the Anthropic provider at another server that speaks the Messages API, such as a proxy.
+	// It excludes the version prefix, for example https://api.anthropic.com.
+	AnthropicBaseUrl string `config_format:"snake" config_default:"https://api.anthropic.com" validate:"required"`
+
+	// OpenaiLegacyMaxTokens sends the output limit of the OpenAI provider as max_tokens instead of
+	// max_completion_tokens, for compatible servers that only understand the older field.
+	OpenaiLegacyMaxTokens bool `config_format:"snake" config_default:"false"`
+
+	// OpenaiHeaders are extra headers sent with every OpenAI request, as comma separated Name=Value pairs.
+	OpenaiHeaders string `config_format:"snake"`
+
+	// OpenaiTimeoutSeconds limits the duration of an OpenAI request including the streamed reply. Zero disables it.
+	OpenaiTimeoutSeconds int `config_format:"snake" config_default:"600"`
+
+	// FakeScriptFile scripts the replies of the fake provider, which echoes the question without it. FakeTokenDelayMs
+	// is the delay between the tokens of its replies.
+	FakeScriptFile   string `config_format:"snake"`
+	FakeTokenDelayMs int    `config_format:"snake" config_default:"20" validate:"gte=0"`
+
+	// CassetteMode records the HTTP responses of the providers to CassetteDir when set to record, and replays them from
+	// it without calling the providers when set to replay.
+	CassetteMode string `config_format:"snake"`
+	CassetteDir  string `config_format:"snake" config_default:"cassettes"`
+}
+
+// ProviderApiKey returns the API key of a provider.
+func (c *Config) ProviderApiKey(provider string) string {
+	var apiKey string
+	switch provider {
+	case ProviderOpenAI:
+		apiKey = c.OpenaiApiKey
+	case ProviderAnthropic:
+		apiKey = c.AnthropicApiKey
+	}
+	if apiKey == "" && provider == c.Provider {
+		apiKey = c.ApiKey
+	}
+	return apiKey
 }
@@ -0,0 +1,181 @@
+package chunks
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+var (
+	//go:embed file_hashes.sql
+	fileHashesSql string
+
+	//go:embed delete_file.sql
+	deleteFileSql string
+
+	//go:embed insert.sql
+	insertSql string
+
+	//go:embed list.sql
+	listSql string
+)
+
+type DAO interface {
+	FileHashes(ctx context.Context, projectId int, embedder string) (map[string]string, error)
+	ReplaceFile(ctx context.Context, projectId int, path string, chunks []*models.RetrievalChunk) error
+	List(ctx context.Context, projectId int, embedder string) ([]*models.RetrievalChunk, error)
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// FileHashes returns the hash of every file of a project indexed by an embedder, by path.
+func (c *dao) FileHashes(ctx context.Context, projectId int, embedder string) (hashes map[string]string, returnErr error) {
+	statement, err := c.db.PrepareContext(ctx, fileHashesSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, projectId, embedder)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	hashes = make(map[string]string)
+	for rows.Next() {
+		var path, hash string
+		if err := rows.Scan(&path, &hash); err != nil {
+			return nil, err
+		}
+		hashes[path] = hash
+	}
+
+	return hashes, nil
+}
+
+// ReplaceFile replaces the chunks of a file of a project, whatever embedder they came from, in a single transaction.
+// A file without chunks is removed from the index.
+func (c *dao) ReplaceFile(ctx context.Context, projectId int, path string, chunks []*models.RetrievalChunk) (returnErr error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction (%w)", err)
+	}
+	defer func() {
+		if returnErr != nil {
+			if err := tx.Rollback(); err != nil {
+				returnErr = errors.Join(returnErr, fmt.Errorf("failed to roll back transaction (%w)", err))
+			}
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, deleteFileSql, projectId, path); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	if len(chunks) > 0 {
+		statement, err := tx.PrepareContext(ctx, insertSql)
+		if err != nil {
+			return fmt.Errorf("error preparing SQL statement (%w)", err)
+		}
+		defer func() {
+			if err := statement.Close(); err != nil {
+				returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+			}
+		}()
+
+		for _, chunk := range chunks {
+			_, err := statement.ExecContext(ctx, projectId, path, chunk.FileHash, chunk.StartLine, chunk.EndLine,
+				chunk.Content, chunk.Embedder, encodeVector(chunk.Vector))
+			if err != nil {
+				return fmt.Errorf("error executing SQL statement (%w)", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction (%w)", err)
+	}
+	return nil
+}
+
+// List returns the chunks of a project indexed by an embedder, with their vectors.
+func (c *dao) List(ctx context.Context, projectId int, embedder string) (chunks []*models.RetrievalChunk, returnErr error) {
+	statement, err := c.db.PrepareContext(ctx, listSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, projectId, embedder)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	chunks = make([]*models.RetrievalChunk, 0)
+	for rows.Next() {
+		chunk := &models.RetrievalChunk{}
+		var vector []byte
+		if err := rows.Scan(&chunk.ProjectId, &chunk.Path, &chunk.FileHash, &chunk.StartLine, &chunk.EndLine,
+			&chunk.Content, &chunk.Embedder, &vector); err != nil {
+			return nil, err
+		}
+		if chunk.Vector, err = decodeVector(vector); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// encodeVector stores a vector as little endian float32 values.
+func encodeVector(vector []float32) []byte {
+	encoded := make([]byte, 4*len(vector))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(encoded[4*i:], math.Float32bits(value))
+	}
+	return encoded
+}
+
+func decodeVector(encoded []byte) ([]float32, error) {
+	if len(encoded)%4 != 0 {
+		return nil, fmt.Errorf("invalid vector of %d bytes", len(encoded))
+	}
+	vector := make([]float32, len(encoded)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(encoded[4*i:]))
+	}
+	return vector, nil
+}
@@ -0,0 +1 @@
+SELECT path, file_hash FROM retrieval_chunks WHERE project_id = ? AND embedder = ? GROUP BY path, file_hash;
\ No newline at end of file
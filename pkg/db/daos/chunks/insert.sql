@@ -0,0 +1,2 @@
+INSERT INTO retrieval_chunks (project_id, path, file_hash, start_line, end_line, content, embedder, vector)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT project_id, path, file_hash, start_line, end_line, content, embedder, vector
+FROM retrieval_chunks
+WHERE project_id = ? AND embedder = ?;
\ No newline at end of file
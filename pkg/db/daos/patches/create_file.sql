@@ -0,0 +1,2 @@
+INSERT INTO patch_set_files (patch_set_id, path, operation, base_hash, applied_hash, backup)
+VALUES (?, ?, ?, ?, ?, ?);
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO patch_sets (project_id, create_time)
+VALUES (?, CURRENT_TIMESTAMP);
\ No newline at end of file
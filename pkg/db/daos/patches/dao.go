@@ -0,0 +1,294 @@
+package patches
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	defaultListLimit = 32
+)
+
+var (
+	//go:embed create_set.sql
+	createSetSql string
+
+	//go:embed create_file.sql
+	createFileSql string
+
+	//go:embed get_set.sql
+	getSetSql string
+
+	//go:embed get_files.sql
+	getFilesSql string
+
+	//go:embed list_sets.sql
+	listSetsSql string
+
+	//go:embed list_files.sql
+	listFilesSql string
+
+	//go:embed revert.sql
+	revertSql string
+
+	//go:embed delete.sql
+	deleteSql string
+)
+
+type ListParameters struct {
+	ProjectId int
+	Limit     *int
+}
+
+type DAO interface {
+	Create(context.Context, *models.PatchSet) error
+	Get(context.Context, *models.PatchSet) error
+	List(context.Context, *ListParameters) ([]*models.PatchSet, error)
+	MarkReverted(context.Context, *models.PatchSet) (bool, error)
+	Delete(context.Context, *models.PatchSet) error
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// Create stores a patch set of a project with the backups of its files, and sets its ID.
+func (p *dao) Create(ctx context.Context, patchSet *models.PatchSet) error {
+	if patchSet.ProjectId == nil {
+		return fmt.Errorf("patch set has no project ID")
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction (%w)", err)
+	}
+	if err := createSet(ctx, tx, patchSet); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to roll back transaction (%w)", rollbackErr))
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction (%w)", err)
+	}
+	return nil
+}
+
+func createSet(ctx context.Context, tx *sql.Tx, patchSet *models.PatchSet) error {
+	result, err := tx.ExecContext(ctx, createSetSql, *patchSet.ProjectId)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error fetching last insert ID (%w)", err)
+	}
+
+	for _, file := range patchSet.Files {
+		if _, err := tx.ExecContext(ctx, createFileSql, id, file.Path, file.Operation, file.BaseHash, file.AppliedHash, file.Backup); err != nil {
+			return fmt.Errorf("error executing SQL statement (%w)", err)
+		}
+	}
+
+	patchSet.Id = ptr.Of(int(id))
+	return nil
+}
+
+// Get fills the patch set with the given ID and project ID, with the backups of its files.
+func (p *dao) Get(ctx context.Context, patchSet *models.PatchSet) (returnErr error) {
+	if patchSet.Id == nil || patchSet.ProjectId == nil {
+		return fmt.Errorf("patch set ID or project ID is nil")
+	}
+
+	statement, err := p.db.PrepareContext(ctx, getSetSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, *patchSet.Id, *patchSet.ProjectId)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	if !rows.Next() {
+		return fmt.Errorf("patch set not found (id=%d, projectId=%d)", *patchSet.Id, *patchSet.ProjectId)
+	}
+	if err := rows.Scan(&patchSet.Id, &patchSet.ProjectId, &patchSet.CreatedTime, &patchSet.RevertTime); err != nil {
+		return err
+	}
+
+	patchSet.Files, err = p.files(ctx, *patchSet.Id)
+	return err
+}
+
+func (p *dao) files(ctx context.Context, patchSetId int) (files []*models.PatchSetFile, returnErr error) {
+	statement, err := p.db.PrepareContext(ctx, getFilesSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, patchSetId)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	files = make([]*models.PatchSetFile, 0)
+	for rows.Next() {
+		file := &models.PatchSetFile{}
+		if err := rows.Scan(&file.Path, &file.Operation, &file.BaseHash, &file.AppliedHash, &file.Backup); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// List returns the latest patch sets of a project, the newest first, without the backups of their files.
+func (p *dao) List(ctx context.Context, params *ListParameters) (patchSets []*models.PatchSet, returnErr error) {
+	listLimit := defaultListLimit
+	if params.Limit != nil {
+		listLimit = *params.Limit
+	}
+
+	setsStatement, err := p.db.PrepareContext(ctx, listSetsSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := setsStatement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	setRows, err := setsStatement.QueryContext(ctx, params.ProjectId, listLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := setRows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	patchSets = make([]*models.PatchSet, 0)
+	byId := make(map[int]*models.PatchSet)
+	for setRows.Next() {
+		patchSet := &models.PatchSet{
+			Files: make([]*models.PatchSetFile, 0),
+		}
+		if err := setRows.Scan(&patchSet.Id, &patchSet.ProjectId, &patchSet.CreatedTime, &patchSet.RevertTime); err != nil {
+			return nil, err
+		}
+		patchSets = append(patchSets, patchSet)
+		byId[*patchSet.Id] = patchSet
+	}
+
+	filesStatement, err := p.db.PrepareContext(ctx, listFilesSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := filesStatement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	fileRows, err := filesStatement.QueryContext(ctx, params.ProjectId, listLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := fileRows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	for fileRows.Next() {
+		var patchSetId int
+		file := &models.PatchSetFile{}
+		if err := fileRows.Scan(&patchSetId, &file.Path, &file.Operation, &file.BaseHash, &file.AppliedHash); err != nil {
+			return nil, err
+		}
+		if patchSet, ok := byId[patchSetId]; ok {
+			patchSet.Files = append(patchSet.Files, file)
+		}
+	}
+
+	return patchSets, nil
+}
+
+// MarkReverted records that the patch set was reverted. It returns false if it was already reverted.
+func (p *dao) MarkReverted(ctx context.Context, patchSet *models.PatchSet) (reverted bool, returnErr error) {
+	statement, err := p.db.PrepareContext(ctx, revertSql)
+	if err != nil {
+		return false, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	result, err := statement.ExecContext(ctx, patchSet.Id)
+	if err != nil {
+		return false, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error fetching rows affected (%w)", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Delete removes a patch set and the backups of its files.
+func (p *dao) Delete(ctx context.Context, patchSet *models.PatchSet) (returnErr error) {
+	statement, err := p.db.PrepareContext(ctx, deleteSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	if _, err := statement.ExecContext(ctx, patchSet.Id); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	return nil
+}
@@ -0,0 +1 @@
+DELETE FROM patch_sets WHERE id = ?;
\ No newline at end of file
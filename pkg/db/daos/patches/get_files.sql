@@ -0,0 +1 @@
+SELECT path, operation, base_hash, applied_hash, backup FROM patch_set_files WHERE patch_set_id = ? ORDER BY id;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT id, project_id, create_time, revert_time FROM patch_sets WHERE id = ? AND project_id = ?;
\ No newline at end of file
@@ -0,0 +1,4 @@
+SELECT f.patch_set_id, f.path, f.operation, f.base_hash, f.applied_hash
+FROM patch_set_files f
+JOIN (SELECT id FROM patch_sets WHERE project_id = ? ORDER BY id DESC LIMIT ?) s ON s.id = f.patch_set_id
+ORDER BY f.id;
\ No newline at end of file
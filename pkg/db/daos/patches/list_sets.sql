@@ -0,0 +1 @@
+SELECT id, project_id, create_time, revert_time FROM patch_sets WHERE project_id = ? ORDER BY id DESC LIMIT ?;
\ No newline at end of file
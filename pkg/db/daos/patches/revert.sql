@@ -0,0 +1,3 @@
+UPDATE patch_sets
+SET revert_time = CURRENT_TIMESTAMP
+WHERE id = ? AND revert_time IS NULL;
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS search_chunks USING fts5(
+    path,
+    content,
+    terms,
+    project_id UNINDEXED,
+    start_line UNINDEXED,
+    end_line UNINDEXED
+);
\ No newline at end of file
@@ -0,0 +1,212 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+var (
+	//go:embed create_chunks_table.sql
+	createChunksTableSql string
+
+	//go:embed files.sql
+	filesSql string
+
+	//go:embed delete_chunks.sql
+	deleteChunksSql string
+
+	//go:embed delete_file.sql
+	deleteFileSql string
+
+	//go:embed delete_project_chunks.sql
+	deleteProjectChunksSql string
+
+	//go:embed insert_chunk.sql
+	insertChunkSql string
+
+	//go:embed insert_file.sql
+	insertFileSql string
+
+	//go:embed search.sql
+	searchSql string
+)
+
+type SearchParameters struct {
+	ProjectId int
+	Query     string
+	Limit     int
+}
+
+type DAO interface {
+	CreateChunksTable(ctx context.Context) error
+	Files(ctx context.Context, projectId int) (map[string]*models.SearchFile, error)
+	ReplaceFile(ctx context.Context, projectId int, file *models.SearchFile, chunks []*models.SearchChunk) error
+	DeleteFile(ctx context.Context, projectId int, path string) error
+	DeleteProject(ctx context.Context, projectId int) error
+	Search(context.Context, *SearchParameters) ([]*models.SearchResult, error)
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// CreateChunksTable creates the FTS5 table of the chunks if it does not exist. The migrations only create it when the
+// server is built with FTS5, so a database that was migrated by a server built without it has no such table.
+func (s *dao) CreateChunksTable(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, createChunksTableSql); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	return nil
+}
+
+// Files returns the indexed files of a project, by path.
+func (s *dao) Files(ctx context.Context, projectId int) (files map[string]*models.SearchFile, returnErr error) {
+	statement, err := s.db.PrepareContext(ctx, filesSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, projectId)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	files = make(map[string]*models.SearchFile)
+	for rows.Next() {
+		file := &models.SearchFile{}
+		if err := rows.Scan(&file.Path, &file.ModTime, &file.Size); err != nil {
+			return nil, err
+		}
+		files[file.Path] = file
+	}
+
+	return files, nil
+}
+
+// ReplaceFile replaces the chunks of a file of a project and records its modification time, in a single transaction.
+func (s *dao) ReplaceFile(ctx context.Context, projectId int, file *models.SearchFile, chunks []*models.SearchChunk) error {
+	return s.inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := deleteFile(ctx, tx, projectId, file.Path); err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			if _, err := tx.ExecContext(ctx, insertChunkSql, chunk.Path, chunk.Content, chunk.Terms, projectId, chunk.StartLine, chunk.EndLine); err != nil {
+				return fmt.Errorf("error executing SQL statement (%w)", err)
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, insertFileSql, projectId, file.Path, file.ModTime, file.Size); err != nil {
+			return fmt.Errorf("error executing SQL statement (%w)", err)
+		}
+		return nil
+	})
+}
+
+// DeleteFile removes a file of a project from the index.
+func (s *dao) DeleteFile(ctx context.Context, projectId int, path string) error {
+	return s.inTransaction(ctx, func(tx *sql.Tx) error {
+		return deleteFile(ctx, tx, projectId, path)
+	})
+}
+
+// DeleteProject removes the chunks of a project. Its files are removed with the project by the foreign key, which the
+// FTS5 table of the chunks cannot have.
+func (s *dao) DeleteProject(ctx context.Context, projectId int) (returnErr error) {
+	statement, err := s.db.PrepareContext(ctx, deleteProjectChunksSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	if _, err := statement.ExecContext(ctx, projectId); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	return nil
+}
+
+func deleteFile(ctx context.Context, tx *sql.Tx, projectId int, path string) error {
+	if _, err := tx.ExecContext(ctx, deleteChunksSql, projectId, path); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	if _, err := tx.ExecContext(ctx, deleteFileSql, projectId, path); err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	return nil
+}
+
+func (s *dao) inTransaction(ctx context.Context, run func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction (%w)", err)
+	}
+	if err := run(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to roll back transaction (%w)", rollbackErr))
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction (%w)", err)
+	}
+	return nil
+}
+
+// Search returns the chunks of a project that match a full-text query, the best match first. The query uses the
+// FTS5 syntax. The score is the BM25 rank of the chunk, where lower is better.
+func (s *dao) Search(ctx context.Context, params *SearchParameters) (results []*models.SearchResult, returnErr error) {
+	statement, err := s.db.PrepareContext(ctx, searchSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, params.Query, params.ProjectId, params.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	results = make([]*models.SearchResult, 0)
+	for rows.Next() {
+		result := &models.SearchResult{}
+		if err := rows.Scan(&result.Path, &result.StartLine, &result.EndLine, &result.Snippet, &result.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
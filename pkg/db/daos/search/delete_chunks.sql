@@ -0,0 +1 @@
+DELETE FROM search_chunks WHERE project_id = ? AND path = ?;
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM search_chunks WHERE project_id = ?;
\ No newline at end of file
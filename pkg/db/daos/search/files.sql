@@ -0,0 +1 @@
+SELECT path, mod_time, size FROM search_files WHERE project_id = ?;
\ No newline at end of file
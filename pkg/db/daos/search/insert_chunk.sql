@@ -0,0 +1 @@
+INSERT INTO search_chunks (path, content, terms, project_id, start_line, end_line) VALUES (?, ?, ?, ?, ?, ?);
\ No newline at end of file
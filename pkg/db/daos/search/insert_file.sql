@@ -0,0 +1 @@
+INSERT INTO search_files (project_id, path, mod_time, size) VALUES (?, ?, ?, ?);
\ No newline at end of file
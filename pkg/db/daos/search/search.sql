@@ -0,0 +1,5 @@
+SELECT path, start_line, end_line, snippet(search_chunks, 1, '**', '**', '...', 32), bm25(search_chunks, 2.0, 1.0, 0.5) AS score
+FROM search_chunks
+WHERE search_chunks MATCH ? AND project_id = ?
+ORDER BY score
+LIMIT ?;
\ No newline at end of file
@@ -0,0 +1,125 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+var (
+	//go:embed get.sql
+	getSql string
+
+	//go:embed upsert.sql
+	upsertSql string
+)
+
+type DAO interface {
+	Get(context.Context, *models.ProjectSettings) error
+	Upsert(context.Context, *models.ProjectSettings) error
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// Defaults returns the settings of a project that has never been configured.
+func Defaults(projectId int) *models.ProjectSettings {
+	return &models.ProjectSettings{
+		ProjectId:        ptr.Of(projectId),
+		ExcludeGenerated: ptr.Of(true),
+		ExcludeVendored:  ptr.Of(true),
+		ExcludeLockFiles: ptr.Of(true),
+	}
+}
+
+// Get fills the settings of the project with the given ID. The defaults are used if the project was never configured.
+func (s *dao) Get(ctx context.Context, settings *models.ProjectSettings) (returnErr error) {
+	if settings.ProjectId == nil {
+		return fmt.Errorf("project ID is nil")
+	}
+
+	statement, err := s.db.PrepareContext(ctx, getSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, *settings.ProjectId)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	if rows.Next() {
+		var generation sql.NullString
+		if err := rows.Scan(&settings.ProjectId, &settings.ExcludeGenerated, &settings.ExcludeVendored, &settings.ExcludeLockFiles, &generation, &settings.MonthlyBudget, &settings.SystemPrompt); err != nil {
+			return err
+		}
+		settings.Generation = nil
+		if generation.Valid {
+			settings.Generation = &models.GenerationOptions{}
+			if err := json.Unmarshal([]byte(generation.String), settings.Generation); err != nil {
+				return fmt.Errorf("error decoding the generation defaults (%w)", err)
+			}
+		}
+		return nil
+	}
+
+	*settings = *Defaults(*settings.ProjectId)
+	return nil
+}
+
+// Upsert stores the settings of a project. Every field must be set, except the generation defaults, the budget and
+// the system prompt.
+func (s *dao) Upsert(ctx context.Context, settings *models.ProjectSettings) (returnErr error) {
+	if settings.ProjectId == nil || settings.ExcludeGenerated == nil || settings.ExcludeVendored == nil || settings.ExcludeLockFiles == nil {
+		return fmt.Errorf("project settings are incomplete (%+v)", settings)
+	}
+
+	var generation sql.NullString
+	if settings.Generation != nil {
+		encoded, err := json.Marshal(settings.Generation)
+		if err != nil {
+			return fmt.Errorf("error encoding the generation defaults (%w)", err)
+		}
+		generation = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	statement, err := s.db.PrepareContext(ctx, upsertSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	_, err = statement.ExecContext(ctx, *settings.ProjectId, *settings.ExcludeGenerated, *settings.ExcludeVendored, *settings.ExcludeLockFiles, generation, settings.MonthlyBudget, settings.SystemPrompt)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	return nil
+}
@@ -0,0 +1 @@
+SELECT project_id, exclude_generated, exclude_vendored, exclude_lock_files, generation, monthly_budget, system_prompt FROM project_settings WHERE project_id = ?;
\ No newline at end of file
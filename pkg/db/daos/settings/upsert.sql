@@ -0,0 +1,10 @@
+INSERT INTO project_settings (project_id, exclude_generated, exclude_vendored, exclude_lock_files, generation, monthly_budget, system_prompt, update_time)
+VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+ON CONFLICT(project_id) DO UPDATE SET
+    exclude_generated = excluded.exclude_generated,
+    exclude_vendored = excluded.exclude_vendored,
+    exclude_lock_files = excluded.exclude_lock_files,
+    generation = excluded.generation,
+    monthly_budget = excluded.monthly_budget,
+    system_prompt = excluded.system_prompt,
+    update_time = CURRENT_TIMESTAMP;
\ No newline at end of file
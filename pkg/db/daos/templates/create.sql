@@ -0,0 +1,2 @@
+INSERT INTO prompt_templates (name, description, content, built_in, create_time, update_time)
+VALUES (?, ?, ?, FALSE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
\ No newline at end of file
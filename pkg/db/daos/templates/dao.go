@@ -0,0 +1,222 @@
+package templates
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	defaultListLimit = 128
+)
+
+var (
+	//go:embed get.sql
+	getSql string
+
+	//go:embed get_by_name.sql
+	getByNameSql string
+
+	//go:embed list.sql
+	listSql string
+
+	//go:embed create.sql
+	createSql string
+
+	//go:embed update.sql
+	updateSql string
+
+	//go:embed delete.sql
+	deleteSql string
+)
+
+type ListParameters struct {
+	Limit *int
+}
+
+type DAO interface {
+	Get(context.Context, *models.PromptTemplate) error
+	List(context.Context, *ListParameters) ([]*models.PromptTemplate, error)
+	Create(context.Context, *models.PromptTemplate) error
+	Update(context.Context, *models.PromptTemplate) (bool, error)
+	Delete(context.Context, *models.PromptTemplate) (bool, error)
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// Get fills the template with the given ID, or with the given name when the ID is nil.
+func (t *dao) Get(ctx context.Context, template *models.PromptTemplate) (returnErr error) {
+	query, key := getSql, any(template.Id)
+	if template.Id == nil {
+		if template.Name == nil {
+			return fmt.Errorf("template ID and name are nil")
+		}
+		query, key = getByNameSql, *template.Name
+	}
+
+	statement, err := t.db.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, key)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	if rows.Next() {
+		return scanTemplate(rows, template)
+	}
+
+	return fmt.Errorf("template not found (%+v)", template)
+}
+
+func (t *dao) List(ctx context.Context, params *ListParameters) (templates []*models.PromptTemplate, returnErr error) {
+	statement, err := t.db.PrepareContext(ctx, listSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	listLimit := defaultListLimit
+	if params.Limit != nil {
+		listLimit = *params.Limit
+	}
+
+	rows, err := statement.QueryContext(ctx, listLimit)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	templates = make([]*models.PromptTemplate, 0)
+	for rows.Next() {
+		template := &models.PromptTemplate{}
+		if err := scanTemplate(rows, template); err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+// Create stores a new template that is not built in. The name, the description and the content must be set.
+func (t *dao) Create(ctx context.Context, template *models.PromptTemplate) (returnErr error) {
+	if template.Name == nil || template.Description == nil || template.Content == nil {
+		return fmt.Errorf("template is incomplete (%+v)", template)
+	}
+
+	statement, err := t.db.PrepareContext(ctx, createSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	result, err := statement.ExecContext(ctx, *template.Name, *template.Description, *template.Content)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error fetching last insert ID (%w)", err)
+	}
+
+	template.Id = ptr.Of(int(id))
+	return nil
+}
+
+// Update stores the name, the description and the content of the template with the given ID. The built-in templates
+// are never updated.
+func (t *dao) Update(ctx context.Context, template *models.PromptTemplate) (updated bool, returnErr error) {
+	if template.Id == nil || template.Name == nil || template.Description == nil || template.Content == nil {
+		return false, fmt.Errorf("template is incomplete (%+v)", template)
+	}
+
+	statement, err := t.db.PrepareContext(ctx, updateSql)
+	if err != nil {
+		return false, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	result, err := statement.ExecContext(ctx, *template.Name, *template.Description, *template.Content, *template.Id)
+	if err != nil {
+		return false, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error fetching rows affected (%w)", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Delete removes the template with the given ID, unless it is built in.
+func (t *dao) Delete(ctx context.Context, template *models.PromptTemplate) (deleted bool, returnErr error) {
+	statement, err := t.db.PrepareContext(ctx, deleteSql)
+	if err != nil {
+		return false, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	result, err := statement.ExecContext(ctx, template.Id)
+	if err != nil {
+		return false, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error fetching rows affected (%w)", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func scanTemplate(rows *sql.Rows, template *models.PromptTemplate) error {
+	return rows.Scan(&template.Id, &template.Name, &template.Description, &template.Content, &template.BuiltIn, &template.CreatedTime, &template.UpdateTime)
+}
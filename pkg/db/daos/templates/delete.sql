@@ -0,0 +1 @@
+DELETE FROM prompt_templates WHERE id = ? AND built_in = FALSE;
\ No newline at end of file
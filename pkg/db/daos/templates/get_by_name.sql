@@ -0,0 +1 @@
+SELECT id, name, description, content, built_in, create_time, update_time FROM prompt_templates WHERE name = ?;
\ No newline at end of file
@@ -0,0 +1,3 @@
+UPDATE prompt_templates
+SET name = ?, description = ?, content = ?, update_time = CURRENT_TIMESTAMP
+WHERE id = ? AND built_in = FALSE;
\ No newline at end of file
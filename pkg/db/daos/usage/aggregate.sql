@@ -0,0 +1,5 @@
+SELECT date(create_time) AS day, project_id, provider, model, COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(cached_tokens), SUM(cost)
+FROM usage_ledger
+WHERE create_time >= ? AND create_time < ? AND (? IS NULL OR project_id = ?)
+GROUP BY day, project_id, provider, model
+ORDER BY day DESC, project_id, provider, model;
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT COALESCE(SUM(cost), 0) FROM usage_ledger WHERE project_id = ? AND create_time >= ?;
\ No newline at end of file
@@ -0,0 +1,126 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// timeFormat matches the format of CURRENT_TIMESTAMP, so times compare correctly with the stored ones.
+	timeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	//go:embed insert.sql
+	insertSql string
+
+	//go:embed aggregate.sql
+	aggregateSql string
+
+	//go:embed cost.sql
+	costSql string
+)
+
+type AggregateParameters struct {
+	ProjectId *int
+	From      time.Time
+	To        time.Time
+}
+
+type DAO interface {
+	Insert(context.Context, *models.UsageRecord) error
+	Aggregate(context.Context, *AggregateParameters) ([]*models.UsageAggregate, error)
+	Cost(ctx context.Context, projectId int, since time.Time) (float64, error)
+}
+
+type dao struct {
+	db *sql.DB
+}
+
+func NewDAO(db *sql.DB) DAO {
+	return &dao{
+		db: db,
+	}
+}
+
+// Insert adds the usage of a chat call to the ledger.
+func (u *dao) Insert(ctx context.Context, record *models.UsageRecord) (returnErr error) {
+	statement, err := u.db.PrepareContext(ctx, insertSql)
+	if err != nil {
+		return fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	_, err = statement.ExecContext(ctx, record.ProjectId, record.Provider, record.Model, record.PromptTokens,
+		record.CompletionTokens, record.CachedTokens, record.Estimated, record.Cost)
+	if err != nil {
+		return fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	return nil
+}
+
+// Aggregate sums the usage between two times by day, project and model. The times are in UTC.
+func (u *dao) Aggregate(ctx context.Context, params *AggregateParameters) (aggregates []*models.UsageAggregate, returnErr error) {
+	statement, err := u.db.PrepareContext(ctx, aggregateSql)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	rows, err := statement.QueryContext(ctx, params.From.UTC().Format(timeFormat), params.To.UTC().Format(timeFormat),
+		params.ProjectId, params.ProjectId)
+	if err != nil {
+		return nil, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close rows (%w)", err))
+		}
+	}()
+
+	aggregates = make([]*models.UsageAggregate, 0)
+	for rows.Next() {
+		aggregate := &models.UsageAggregate{}
+		if err := rows.Scan(&aggregate.Day, &aggregate.ProjectId, &aggregate.Provider, &aggregate.Model, &aggregate.Calls,
+			&aggregate.PromptTokens, &aggregate.CompletionTokens, &aggregate.CachedTokens, &aggregate.Cost); err != nil {
+			return nil, err
+		}
+		aggregates = append(aggregates, aggregate)
+	}
+
+	return aggregates, nil
+}
+
+// Cost returns the cost of the chat calls of a project since a time.
+func (u *dao) Cost(ctx context.Context, projectId int, since time.Time) (cost float64, returnErr error) {
+	statement, err := u.db.PrepareContext(ctx, costSql)
+	if err != nil {
+		return 0, fmt.Errorf("error preparing SQL statement (%w)", err)
+	}
+	defer func() {
+		if err := statement.Close(); err != nil {
+			returnErr = errors.Join(returnErr, fmt.Errorf("failed to close statement (%w)", err))
+		}
+	}()
+
+	if err := statement.QueryRowContext(ctx, projectId, since.UTC().Format(timeFormat)).Scan(&cost); err != nil {
+		return 0, fmt.Errorf("error executing SQL statement (%w)", err)
+	}
+
+	return cost, nil
+}
@@ -0,0 +1,2 @@
+INSERT INTO usage_ledger (project_id, provider, model, prompt_tokens, completion_tokens, cached_tokens, estimated, cost, create_time)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP);
\ No newline at end of file
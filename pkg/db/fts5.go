@@ -0,0 +1,6 @@
+//go:build sqlite_fts5
+
+package db
+
+// FTS5Enabled reports whether the SQLite driver is built with the FTS5 full-text search extension.
+const FTS5Enabled = true
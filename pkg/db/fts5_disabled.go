@@ -0,0 +1,7 @@
+//go:build !sqlite_fts5
+
+package db
+
+// FTS5Enabled reports whether the SQLite driver is built with the FTS5 full-text search extension. Build with
+// -tags sqlite_fts5 to enable it.
+const FTS5Enabled = false
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   2,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS project_settings (
+					project_id INTEGER PRIMARY KEY REFERENCES projects(id) ON DELETE CASCADE,
+					exclude_generated BOOLEAN NOT NULL DEFAULT 1,
+					exclude_vendored BOOLEAN NOT NULL DEFAULT 1,
+					exclude_lock_files BOOLEAN NOT NULL DEFAULT 1,
+					update_time DATETIME NOT NULL
+				);
+			`)
+			return err
+		},
+	})
+}
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   3,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				ALTER TABLE project_settings ADD COLUMN generation TEXT;
+			`)
+			return err
+		},
+	})
+}
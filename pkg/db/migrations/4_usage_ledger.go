@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   4,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS usage_ledger (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL,
+					provider TEXT NOT NULL,
+					model TEXT NOT NULL,
+					prompt_tokens INTEGER NOT NULL,
+					completion_tokens INTEGER NOT NULL,
+					cached_tokens INTEGER NOT NULL,
+					estimated BOOLEAN NOT NULL,
+					cost REAL NOT NULL,
+					create_time DATETIME NOT NULL
+				);
+				CREATE INDEX IF NOT EXISTS usage_ledger_project_time ON usage_ledger (project_id, create_time);
+				ALTER TABLE project_settings ADD COLUMN monthly_budget REAL;
+			`)
+			return err
+		},
+	})
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   5,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS retrieval_chunks (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					path TEXT NOT NULL,
+					file_hash TEXT NOT NULL,
+					start_line INTEGER NOT NULL,
+					end_line INTEGER NOT NULL,
+					content TEXT NOT NULL,
+					embedder TEXT NOT NULL,
+					vector BLOB NOT NULL
+				);
+				CREATE INDEX IF NOT EXISTS retrieval_chunks_project_path ON retrieval_chunks (project_id, path);
+			`)
+			return err
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+// The chunks of the search index are an FTS5 table, so they are only created when the server is built with it.
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   6,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS search_files (
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					path TEXT NOT NULL,
+					mod_time DATETIME NOT NULL,
+					size INTEGER NOT NULL,
+					PRIMARY KEY (project_id, path)
+				);
+			`)
+			if err != nil || !db.FTS5Enabled {
+				return err
+			}
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE VIRTUAL TABLE IF NOT EXISTS search_chunks USING fts5(
+					path,
+					content,
+					terms,
+					project_id UNINDEXED,
+					start_line UNINDEXED,
+					end_line UNINDEXED
+				);
+			`)
+			return err
+		},
+	})
+}
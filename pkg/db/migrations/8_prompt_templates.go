@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   8,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS prompt_templates (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					description TEXT NOT NULL,
+					content TEXT NOT NULL,
+					built_in BOOLEAN NOT NULL,
+					create_time DATETIME NOT NULL,
+					update_time DATETIME NOT NULL
+				);
+				INSERT INTO prompt_templates (name, description, content, built_in, create_time, update_time) VALUES
+				(
+					'review-package',
+					'Review a package for bugs, unclear code and missing error handling.',
+					'Review the {{package}} package. Point out bugs, race conditions, unhandled errors and code that is hard to follow, with the file and the lines of every finding, and suggest a fix for each of them.',
+					TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+				),
+				(
+					'table-driven-tests',
+					'Write table-driven tests for a function or a type.',
+					'Write table-driven tests for {{target}}. Cover the normal cases, the edge cases and the errors, follow the conventions of the existing tests, and explain what every case checks.',
+					TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+				),
+				(
+					'explain-error',
+					'Explain an error message and how to fix it.',
+					'Explain this error and where it comes from in the codebase, then suggest how to fix it.
+
+{{error}}',
+					TRUE, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+				);
+			`)
+			return err
+		},
+	})
+}
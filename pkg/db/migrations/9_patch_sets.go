@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	basemigration "github.com/TriangleSide/GoTools/pkg/database/migration"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+func init() {
+	basemigration.MustRegister(&basemigration.Registration{
+		Order:   9,
+		Enabled: true,
+		Migrate: func(ctx context.Context) error {
+			database, err := db.NewSQLiteDB()
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err = database.Close(); err != nil {
+					logger.Errorf("Failed to close database connection: %s", err.Error())
+				}
+			}()
+			_, err = database.DB().ExecContext(ctx, `
+				CREATE TABLE IF NOT EXISTS patch_sets (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+					create_time DATETIME NOT NULL,
+					revert_time DATETIME
+				);
+				CREATE INDEX IF NOT EXISTS patch_sets_project ON patch_sets (project_id, id);
+				CREATE TABLE IF NOT EXISTS patch_set_files (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					patch_set_id INTEGER NOT NULL REFERENCES patch_sets(id) ON DELETE CASCADE,
+					path TEXT NOT NULL,
+					operation TEXT NOT NULL,
+					base_hash TEXT NOT NULL,
+					applied_hash TEXT NOT NULL,
+					backup BLOB
+				);
+				CREATE INDEX IF NOT EXISTS patch_set_files_set ON patch_set_files (patch_set_id);
+			`)
+			return err
+		},
+	})
+}
@@ -9,7 +9,7 @@ import (
 
 const (
 	driverName   = "sqlite3"
-	databaseFile = "sqlite.db"
+	databaseFile = "sqlite.db?_foreign_keys=on"
 )
 
 type SQLiteDB struct {
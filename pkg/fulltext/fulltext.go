@@ -0,0 +1,196 @@
+package fulltext
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/db"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/search"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+var (
+	// identifierPattern matches the identifiers of a text, without their underscores.
+	identifierPattern = regexp.MustCompile(`[A-Za-z0-9]+`)
+)
+
+const (
+	// chunkLines is the length of the chunks the files are split in. A result points at a chunk.
+	chunkLines = 40
+
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// Index keeps a full-text index of the files of the projects. It is updated incrementally from the modification
+// times of the files of the amalgam.
+type Index struct {
+	searchDAO search.DAO
+
+	// updating serializes the updates, so that concurrent searches do not index the same files twice.
+	updating sync.Mutex
+}
+
+// DisabledError is returned when the server is built without FTS5.
+type DisabledError struct{}
+
+func (e *DisabledError) Error() string {
+	return "full-text search needs a server built with -tags sqlite_fts5"
+}
+
+func New(searchDAO search.DAO) *Index {
+	return &Index{
+		searchDAO: searchDAO,
+	}
+}
+
+// Update indexes the files of the amalgam of a project that changed since the last update, and removes the files that
+// are gone.
+func (i *Index) Update(ctx context.Context, projectId int, root string, options *models.AmalgamOptions) error {
+	if !db.FTS5Enabled {
+		return &DisabledError{}
+	}
+
+	i.updating.Lock()
+	defer i.updating.Unlock()
+
+	files, err := amalgam.List(ctx, root, options)
+	if err != nil {
+		return fmt.Errorf("error listing the project files (%w)", err)
+	}
+	indexed, err := i.searchDAO.Files(ctx, projectId)
+	if err != nil {
+		return fmt.Errorf("error reading the search index of the project (%w)", err)
+	}
+
+	changed := make(map[string]*amalgam.FileInfo)
+	changedPaths := make([]string, 0)
+	for _, file := range files {
+		previous, ok := indexed[file.Path]
+		if !ok || !previous.ModTime.Equal(file.ModTime) || previous.Size != file.Size {
+			changed[file.Path] = file
+			changedPaths = append(changedPaths, file.Path)
+		}
+		delete(indexed, file.Path)
+	}
+	for removed := range indexed {
+		if err := i.searchDAO.DeleteFile(ctx, projectId, removed); err != nil {
+			return fmt.Errorf("error removing %s from the search index (%w)", removed, err)
+		}
+	}
+	if len(changedPaths) == 0 {
+		return nil
+	}
+	logger.Infof("Indexing %d changed files of project %d for search.", len(changedPaths), projectId)
+
+	contents, err := amalgam.Read(root, changedPaths)
+	if err != nil {
+		return fmt.Errorf("error reading the project files (%w)", err)
+	}
+	for _, content := range contents {
+		info := changed[content.Path]
+		file := &models.SearchFile{
+			Path:    content.Path,
+			ModTime: info.ModTime,
+			Size:    info.Size,
+		}
+		if err := i.searchDAO.ReplaceFile(ctx, projectId, file, chunkFile(content)); err != nil {
+			return fmt.Errorf("error indexing %s (%w)", content.Path, err)
+		}
+	}
+	return nil
+}
+
+// Remove removes the chunks of a deleted project from the index. It does nothing when the server is built without FTS5,
+// since nothing was indexed.
+func (i *Index) Remove(ctx context.Context, projectId int) error {
+	if !db.FTS5Enabled {
+		return nil
+	}
+	i.updating.Lock()
+	defer i.updating.Unlock()
+	if err := i.searchDAO.DeleteProject(ctx, projectId); err != nil {
+		return fmt.Errorf("error removing the project from the search index (%w)", err)
+	}
+	return nil
+}
+
+// Search returns the chunks of a project that contain every word of the query, the best match first. A word that
+// ends with * matches the words that start with it. A query without words is an *ai.ValidationError.
+func (i *Index) Search(ctx context.Context, projectId int, query string, limit *int) ([]*models.SearchResult, error) {
+	if !db.FTS5Enabled {
+		return nil, &DisabledError{}
+	}
+	ftsQuery := buildQuery(query)
+	if ftsQuery == "" {
+		return nil, &ai.ValidationError{Err: fmt.Errorf("the search query has no words")}
+	}
+	resultLimit := defaultLimit
+	if limit != nil {
+		resultLimit = min(max(*limit, 1), maxLimit)
+	}
+	return i.searchDAO.Search(ctx, &search.SearchParameters{
+		ProjectId: projectId,
+		Query:     ftsQuery,
+		Limit:     resultLimit,
+	})
+}
+
+// buildQuery quotes every word of a query, so that the characters with a meaning in the FTS5 syntax are searched
+// for as they are.
+func buildQuery(query string) string {
+	terms := make([]string, 0)
+	for _, word := range strings.Fields(query) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.ReplaceAll(strings.TrimRight(word, "*"), `"`, `""`)
+		if word == "" {
+			continue
+		}
+		term := `"` + word + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
+
+// identifierTerms returns the words of the camel case identifiers of a text, such as parseHTTPRequest. The full-text
+// index already splits identifiers on underscores, but not on case.
+func identifierTerms(text string) string {
+	terms := make([]string, 0)
+	for _, identifier := range identifierPattern.FindAllString(text, -1) {
+		words := ai.SplitIdentifier(identifier)
+		if len(words) > 1 {
+			terms = append(terms, words...)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// chunkFile splits a file into chunks of chunkLines lines.
+func chunkFile(file *amalgam.File) []*models.SearchChunk {
+	lines := strings.Split(strings.TrimSuffix(file.Content, "\n"), "\n")
+	chunks := make([]*models.SearchChunk, 0, len(lines)/chunkLines+1)
+	for start := 0; start < len(lines); start += chunkLines {
+		end := min(start+chunkLines, len(lines))
+		content := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(content) == "" {
+			continue
+		}
+		chunks = append(chunks, &models.SearchChunk{
+			Path:      file.Path,
+			StartLine: start + 1,
+			EndLine:   end,
+			Content:   content,
+			Terms:     identifierTerms(content),
+		})
+	}
+	return chunks
+}
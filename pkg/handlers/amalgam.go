@@ -1,25 +1,32 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
 	"github.com/TriangleSide/CodebaseAI/pkg/api"
 	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/middleware"
 	"github.com/TriangleSide/CodebaseAI/pkg/models"
 	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	basemiddleware "github.com/TriangleSide/GoTools/pkg/http/middleware"
 	"github.com/TriangleSide/GoTools/pkg/http/responders"
 	"github.com/TriangleSide/GoTools/pkg/logger"
 	"github.com/TriangleSide/GoTools/pkg/ptr"
 )
 
 type Amalgam struct {
-	projectDAO projects.DAO
+	projectDAO  projects.DAO
+	settingsDAO settings.DAO
 }
 
-func NewAmalgam(projectDAO projects.DAO) *Amalgam {
+func NewAmalgam(projectDAO projects.DAO, settingsDAO settings.DAO) *Amalgam {
 	return &Amalgam{
-		projectDAO: projectDAO,
+		projectDAO:  projectDAO,
+		settingsDAO: settingsDAO,
 	}
 }
 
@@ -34,25 +41,97 @@ func (a *Amalgam) Get(w http.ResponseWriter, r *http.Request) {
 			return nil, 0, err
 		}
 
-		amalgamContent, tokenCount, err := amalgam.Get(r.Context(), *project.Path)
+		projectSettings := &models.ProjectSettings{
+			ProjectId: project.Id,
+		}
+		if err := a.settingsDAO.Get(r.Context(), projectSettings); err != nil {
+			logger.Errorf("Failed to get project settings (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		amalgamResponse, err := amalgam.Get(r.Context(), *project.Path, amalgamOptions(requestParameters, projectSettings))
 		if err != nil {
 			logger.Errorf("Failed to get amalgam (%s).", err.Error())
 			return nil, 0, err
 		}
 
-		return &models.AmalgamResponse{
-			Content:    amalgamContent,
-			TokenCount: tokenCount,
-		}, http.StatusOK, nil
+		// The middleware answers with 304 Not Modified when the client already has this version.
+		w.Header().Set("ETag", fmt.Sprintf("W/\"%s\"", amalgamResponse.Hash))
+		w.Header().Set("Cache-Control", "no-cache")
+
+		return amalgamResponse, http.StatusOK, nil
 	}, responders.WithErrorCallback(func(err error) {
 		logger.Errorf("Error while handling request (%s).", err.Error())
 	}))
 }
 
+func (a *Amalgam) Explain(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.AmalgamRequest) (*models.AmalgamExplainResponse, int, error) {
+		project := &models.Project{
+			Id: ptr.Of(requestParameters.ProjectId),
+		}
+		err := a.projectDAO.Get(r.Context(), project)
+		if err != nil {
+			logger.Errorf("Failed to get project (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		projectSettings := &models.ProjectSettings{
+			ProjectId: project.Id,
+		}
+		if err := a.settingsDAO.Get(r.Context(), projectSettings); err != nil {
+			logger.Errorf("Failed to get project settings (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		explainResponse, err := amalgam.Explain(r.Context(), *project.Path, amalgamOptions(requestParameters, projectSettings))
+		if err != nil {
+			logger.Errorf("Failed to explain amalgam (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		return explainResponse, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+// amalgamOptions converts the query parameters of an amalgam request to options on top of the project settings. The
+// include and exclude patterns are comma separated.
+func amalgamOptions(requestParameters *models.AmalgamRequest, projectSettings *models.ProjectSettings) *models.AmalgamOptions {
+	return &models.AmalgamOptions{
+		Include:          splitQueryList(requestParameters.Include),
+		Exclude:          splitQueryList(requestParameters.Exclude),
+		IncludeTests:     requestParameters.IncludeTests,
+		ExcludeGenerated: projectSettings.ExcludeGenerated,
+		ExcludeVendored:  projectSettings.ExcludeVendored,
+		ExcludeLockFiles: projectSettings.ExcludeLockFiles,
+	}
+}
+
+func splitQueryList(value *string) []string {
+	if value == nil {
+		return nil
+	}
+	list := make([]string, 0)
+	for _, item := range strings.Split(*value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func (a *Amalgam) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
 	builder.MustRegister(api.PathAmalgam, http.MethodOptions, nil)
 	builder.MustRegister(api.PathAmalgam, http.MethodGet, &baseapi.Handler{
-		Middleware: nil,
+		Middleware: []basemiddleware.Middleware{middleware.Compress, middleware.ConditionalGet},
 		Handler:    a.Get,
 	})
+
+	builder.MustRegister(api.PathAmalgamExplain, http.MethodOptions, nil)
+	builder.MustRegister(api.PathAmalgamExplain, http.MethodGet, &baseapi.Handler{
+		Middleware: []basemiddleware.Middleware{middleware.Compress},
+		Handler:    a.Explain,
+	})
 }
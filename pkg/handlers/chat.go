@@ -1,36 +1,373 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/registry"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/tools"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
 	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/templates"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/usage"
 	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/CodebaseAI/pkg/patch"
+	"github.com/TriangleSide/CodebaseAI/pkg/retrieval"
 	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
 	"github.com/TriangleSide/GoTools/pkg/http/responders"
 	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
 )
 
+// budgetError is returned when a project has spent its monthly budget.
+type budgetError struct {
+	projectId int
+	spent     float64
+	budget    float64
+	since     time.Time
+}
+
+func (e *budgetError) Error() string {
+	return fmt.Sprintf("project %d has spent $%.2f of its monthly budget of $%.2f since %s, chat is disabled until next month", e.projectId, e.spent, e.budget, e.since.Format(time.DateOnly))
+}
+
 type Chat struct {
-	aiChat ai.Chat
+	registry       *registry.Registry
+	retrievalIndex *retrieval.Index
+	projectDAO     projects.DAO
+	settingsDAO    settings.DAO
+	templateDAO    templates.DAO
+	usageDAO       usage.DAO
 }
 
-func NewChat(aiChat ai.Chat) *Chat {
+func NewChat(registry *registry.Registry, retrievalIndex *retrieval.Index, projectDAO projects.DAO, settingsDAO settings.DAO, templateDAO templates.DAO, usageDAO usage.DAO) *Chat {
 	return &Chat{
-		aiChat: aiChat,
+		registry:       registry,
+		retrievalIndex: retrievalIndex,
+		projectDAO:     projectDAO,
+		settingsDAO:    settingsDAO,
+		templateDAO:    templateDAO,
+		usageDAO:       usageDAO,
 	}
 }
 
 func (c *Chat) Stream(w http.ResponseWriter, r *http.Request) {
 	responders.JSONStream(w, r, func(requestParameters *models.ChatRequest) (<-chan *models.ChatResponse, int, error) {
-		tokenStream, err := c.aiChat.Stream(r.Context(), requestParameters)
+		return c.stream(r.Context(), requestParameters)
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+// stream prepares the request in its mode and streams the reply of the selected model, with its usage recorded.
+func (c *Chat) stream(ctx context.Context, request *models.ChatRequest) (<-chan *models.ChatResponse, int, error) {
+	model, err := c.registry.Lookup(request.Provider, request.Model)
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Provider = ptr.Of(model.Provider)
+	request.Model = ptr.Of(model.Name)
+
+	mode := ""
+	if request.Mode != nil {
+		mode = *request.Mode
+		switch mode {
+		case models.ChatModeAgent, models.ChatModeRetrieval, models.ChatModePatch:
+		default:
+			return nil, 0, &ai.ValidationError{Err: fmt.Errorf("unknown chat mode '%s'", mode)}
+		}
+		if request.ProjectId == nil {
+			return nil, 0, &ai.ValidationError{Err: fmt.Errorf("the %s mode needs a project ID", mode)}
+		}
+	}
+
+	if request.Template != nil {
+		if err := c.renderTemplate(ctx, request); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var project *models.Project
+	var amalgamOptions *models.AmalgamOptions
+	if request.ProjectId != nil {
+		project, amalgamOptions, err = c.loadProject(ctx, request)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := ai.ValidateGeneration(request.Generation); err != nil {
+		return nil, 0, err
+	}
+
+	var tokenStream <-chan *models.ChatResponse
+	if mode == models.ChatModeAgent {
+		toolbox, err := tools.New(*project.Path, amalgamOptions)
 		if err != nil {
 			return nil, 0, err
 		}
+		tokenStream, err = c.registry.Agent(ctx, request, toolbox)
+		if err != nil {
+			return nil, 0, err
+		}
+	} else {
+		if mode == models.ChatModeRetrieval {
+			if err := c.addRetrievedCode(ctx, request, project, amalgamOptions); err != nil {
+				return nil, 0, err
+			}
+		} else if project != nil {
+			if err := addCodebase(ctx, request, project, amalgamOptions); err != nil {
+				return nil, 0, err
+			}
+		}
+		if mode == models.ChatModePatch {
+			request.SystemPrompt = ptr.Of(ai.SystemPrompt(request) + "\n\n" + ai.PatchInstructions)
+		}
+		tokenStream, err = c.registry.Stream(ctx, request)
+		if err != nil {
+			return nil, 0, err
+		}
+		if mode == models.ChatModePatch {
+			tokenStream = withPatches(ctx, *project.Path, tokenStream)
+		}
+	}
+	if c.registry.Replaying() {
+		// A replayed chat did not call the provider, so it is not charged.
 		return tokenStream, http.StatusOK, nil
-	}, responders.WithErrorCallback(func(err error) {
-		logger.Errorf("Error while handling request (%s).", err.Error())
-	}))
+	}
+	return c.recordUsage(ctx, request, model, tokenStream), http.StatusOK, nil
+}
+
+// loadProject applies the generation defaults of the project to the request and returns the project with its amalgam
+// options. The amalgam options of the request are merged on top of the project settings, and the system prompt of the
+// project is resolved. An error is returned if the project has spent its monthly budget.
+func (c *Chat) loadProject(ctx context.Context, request *models.ChatRequest) (*models.Project, *models.AmalgamOptions, error) {
+	project := &models.Project{
+		Id: request.ProjectId,
+	}
+	if err := c.projectDAO.Get(ctx, project); err != nil {
+		logger.Errorf("Failed to get project (%s).", err.Error())
+		return nil, nil, err
+	}
+
+	projectSettings := &models.ProjectSettings{
+		ProjectId: project.Id,
+	}
+	if err := c.settingsDAO.Get(ctx, projectSettings); err != nil {
+		logger.Errorf("Failed to get project settings (%s).", err.Error())
+		return nil, nil, err
+	}
+	request.Generation = ai.MergeGeneration(projectSettings.Generation, request.Generation)
+
+	if projectSettings.MonthlyBudget != nil {
+		now := time.Now().UTC()
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		spent, err := c.usageDAO.Cost(ctx, *project.Id, monthStart)
+		if err != nil {
+			logger.Errorf("Failed to get the project spending (%s).", err.Error())
+			return nil, nil, err
+		}
+		if spent >= *projectSettings.MonthlyBudget {
+			return nil, nil, &budgetError{
+				projectId: *project.Id,
+				spent:     spent,
+				budget:    *projectSettings.MonthlyBudget,
+				since:     monthStart,
+			}
+		}
+	}
+
+	options := &models.AmalgamOptions{}
+	if request.Amalgam != nil {
+		*options = *request.Amalgam
+	}
+	if options.ExcludeGenerated == nil {
+		options.ExcludeGenerated = projectSettings.ExcludeGenerated
+	}
+	if options.ExcludeVendored == nil {
+		options.ExcludeVendored = projectSettings.ExcludeVendored
+	}
+	if options.ExcludeLockFiles == nil {
+		options.ExcludeLockFiles = projectSettings.ExcludeLockFiles
+	}
+	if err := amalgam.ValidateOptions(options); err != nil {
+		return nil, nil, err
+	}
+
+	if projectSettings.SystemPrompt != nil {
+		systemPrompt, err := resolvePrompt(ctx, *projectSettings.SystemPrompt, project, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		request.SystemPrompt = &systemPrompt
+	}
+
+	return project, options, nil
+}
+
+// renderTemplate renders the prompt template of the request with its variable values and appends it to the messages
+// as the question of the user. Every variable of the template needs a value, and every value needs a variable.
+func (c *Chat) renderTemplate(ctx context.Context, request *models.ChatRequest) error {
+	if request.Template.Id == nil && request.Template.Name == nil {
+		return &ai.ValidationError{Err: fmt.Errorf("the template needs an ID or a name")}
+	}
+	template := &models.PromptTemplate{
+		Id:   request.Template.Id,
+		Name: request.Template.Name,
+	}
+	if err := c.templateDAO.Get(ctx, template); err != nil {
+		logger.Errorf("Failed to get prompt template (%s).", err.Error())
+		return err
+	}
+
+	variables := ai.TemplateVariables(*template.Content)
+	for name := range request.Template.Variables {
+		if !slices.Contains(variables, name) {
+			return &ai.ValidationError{Err: fmt.Errorf("the template '%s' has no variable {{%s}}", *template.Name, name)}
+		}
+	}
+	content, err := ai.RenderTemplate(*template.Content, request.Template.Variables)
+	if err != nil {
+		return &ai.ValidationError{Err: fmt.Errorf("failed to render the template '%s' (%w)", *template.Name, err)}
+	}
+
+	request.Messages = append(request.Messages, models.ChatMessage{
+		Role:    models.ChatRoleUser,
+		Content: content,
+	})
+	return nil
+}
+
+// addCodebase adds the amalgam of the project to the request.
+func addCodebase(ctx context.Context, request *models.ChatRequest, project *models.Project, options *models.AmalgamOptions) error {
+	amalgamResponse, err := amalgam.Get(ctx, *project.Path, options)
+	if err != nil {
+		logger.Errorf("Failed to get amalgam (%s).", err.Error())
+		return err
+	}
+	request.Codebase = ptr.Of(amalgamResponse.Content)
+	request.CodebaseTokenCount = ptr.Of(amalgamResponse.TokenCount)
+
+	return nil
+}
+
+// addRetrievedCode prepares the retrieval index of the project and adds the chunks that are the most similar to the
+// latest question to the request.
+func (c *Chat) addRetrievedCode(ctx context.Context, request *models.ChatRequest, project *models.Project, options *models.AmalgamOptions) error {
+	question := ""
+	for i := len(request.Messages) - 1; i >= 0 && question == ""; i-- {
+		if request.Messages[i].Role == models.ChatRoleUser {
+			question = request.Messages[i].Content
+		}
+	}
+	if question == "" {
+		return &ai.ValidationError{Err: fmt.Errorf("the retrieval mode needs a question from the user")}
+	}
+
+	if err := c.retrievalIndex.Prepare(ctx, *project.Id, *project.Path, options); err != nil {
+		logger.Errorf("Failed to update the retrieval index (%s).", err.Error())
+		return err
+	}
+	retrieved, err := c.retrievalIndex.Search(ctx, *project.Id, *project.Path, options, question)
+	if err != nil {
+		logger.Errorf("Failed to search the retrieval index (%s).", err.Error())
+		return err
+	}
+	request.Codebase = ptr.Of(retrieval.Render(retrieved))
+
+	return nil
+}
+
+// withPatches forwards a token stream and adds the patches parsed from the whole answer to its final message, validated
+// against the files of the project at root. The diffs that cannot be parsed are kept as invalid patches.
+func withPatches(ctx context.Context, root string, tokens <-chan *models.ChatResponse) <-chan *models.ChatResponse {
+	forwarded := make(chan *models.ChatResponse)
+	go func() {
+		defer close(forwarded)
+		var answer strings.Builder
+		for msg := range tokens {
+			if msg.Content != nil {
+				answer.WriteString(*msg.Content)
+			}
+			if msg.Done != nil && *msg.Done && msg.Error == nil {
+				patches := patch.Parse(answer.String())
+				parsed := make([]*models.FilePatch, 0, len(patches))
+				for _, filePatch := range patches {
+					if len(filePatch.Errors) == 0 {
+						parsed = append(parsed, filePatch)
+					}
+				}
+				patch.Validate(root, parsed)
+				msg.Patches = patches
+			}
+			if !ai.SendOverChannel(ctx, forwarded, msg) {
+				return
+			}
+		}
+	}()
+	return forwarded
+}
+
+// recordUsage forwards a token stream and adds the usage reported on its final message to the ledger. A stream that
+// fails or that the client leaves has no reported usage once the model started answering, so an estimate of its prompt
+// and of the answer received so far is recorded instead. A stream that fails before the model answered was rejected by
+// the provider and is not recorded.
+func (c *Chat) recordUsage(ctx context.Context, request *models.ChatRequest, model *models.Model, tokens <-chan *models.ChatResponse) <-chan *models.ChatResponse {
+	forwarded := make(chan *models.ChatResponse)
+	go func() {
+		defer close(forwarded)
+
+		recorded := false
+		answered := false
+		reply := strings.Builder{}
+		defer func() {
+			if !recorded && (answered || ctx.Err() != nil) {
+				c.insertUsage(ctx, request.ProjectId, model, ai.EstimateUsage(model.Name, request, reply.String()))
+			}
+		}()
+
+		for msg := range tokens {
+			if msg.Content != nil {
+				reply.WriteString(*msg.Content)
+				answered = true
+			}
+			if msg.ToolCall != nil {
+				answered = true
+			}
+			if msg.Usage != nil {
+				c.insertUsage(ctx, request.ProjectId, model, msg.Usage)
+				recorded = true
+			}
+			if !ai.SendOverChannel(ctx, forwarded, msg) {
+				return
+			}
+		}
+	}()
+	return forwarded
+}
+
+// insertUsage adds the usage of a chat to the ledger. The usage is recorded even if the client went away before the
+// end of the stream.
+func (c *Chat) insertUsage(ctx context.Context, projectId *int, model *models.Model, usage *models.ChatUsage) {
+	record := &models.UsageRecord{
+		ProjectId:        projectId,
+		Provider:         model.Provider,
+		Model:            model.Name,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		CachedTokens:     usage.CachedTokens,
+		Estimated:        usage.Estimated,
+		Cost:             ai.Cost(model, usage),
+	}
+	if err := c.usageDAO.Insert(context.WithoutCancel(ctx), record); err != nil {
+		logger.Errorf("Failed to record the chat usage (%s).", err.Error())
+	}
 }
 
 func (c *Chat) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
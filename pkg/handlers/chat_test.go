@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/cassette"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/fake"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/registry"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/templates"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/usage"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	testProjectId = 1
+	testModel     = "fake-model"
+)
+
+type fakeProjectDAO struct {
+	projects.DAO
+	root string
+}
+
+func (f *fakeProjectDAO) Get(_ context.Context, project *models.Project) error {
+	if *project.Id != testProjectId {
+		return errors.New("project not found")
+	}
+	project.Path = ptr.Of(f.root)
+	return nil
+}
+
+type fakeSettingsDAO struct {
+	settings *models.ProjectSettings
+}
+
+func (f *fakeSettingsDAO) Get(_ context.Context, projectSettings *models.ProjectSettings) error {
+	if f.settings != nil {
+		*projectSettings = *f.settings
+	}
+	return nil
+}
+
+func (f *fakeSettingsDAO) Upsert(context.Context, *models.ProjectSettings) error {
+	return nil
+}
+
+type fakeTemplateDAO struct {
+	templates.DAO
+}
+
+func (f *fakeTemplateDAO) Get(_ context.Context, template *models.PromptTemplate) error {
+	if template.Name == nil || *template.Name != "greet" {
+		return errors.New("template not found")
+	}
+	template.Content = ptr.Of("Say hello to {{name}}.")
+	return nil
+}
+
+type fakeUsageDAO struct {
+	usage.DAO
+	records chan *models.UsageRecord
+	spent   float64
+}
+
+func (f *fakeUsageDAO) Insert(_ context.Context, record *models.UsageRecord) error {
+	f.records <- record
+	return nil
+}
+
+func (f *fakeUsageDAO) Cost(context.Context, int, time.Time) (float64, error) {
+	return f.spent, nil
+}
+
+// chatFixture is a chat handler with the fake provider and a project in a temporary directory.
+type chatFixture struct {
+	chat     *Chat
+	root     string
+	settings *fakeSettingsDAO
+	usage    *fakeUsageDAO
+}
+
+func newChatFixture(t *testing.T, script *fake.Script, cassetteMode string) *chatFixture {
+	t.Helper()
+	directory := t.TempDir()
+	root := filepath.Join(directory, "project")
+	writeFile(t, filepath.Join(root, "main.go"), "package main\n\nfunc main() {\n}\n")
+
+	scriptFile := filepath.Join(directory, "fake.json")
+	data, err := json.Marshal(script)
+	if err != nil {
+		t.Fatalf("failed to encode the script (%s)", err)
+	}
+	writeFile(t, scriptFile, string(data))
+	modelsFile := filepath.Join(directory, "models.json")
+	writeFile(t, modelsFile, `{"models": [{"provider": "fake", "name": "`+testModel+`", "contextWindow": 100000, "inputPrice": 1, "outputPrice": 1}]}`)
+
+	providerRegistry, err := registry.New(&config.Config{
+		Provider:       config.ProviderFake,
+		ModelVersion:   testModel,
+		ModelsFile:     modelsFile,
+		AgentMaxSteps:  4,
+		FakeScriptFile: scriptFile,
+		CassetteMode:   cassetteMode,
+		CassetteDir:    filepath.Join(directory, "cassettes"),
+	})
+	if err != nil {
+		t.Fatalf("failed to create the registry (%s)", err)
+	}
+
+	fixture := &chatFixture{
+		root:     root,
+		settings: &fakeSettingsDAO{},
+		usage:    &fakeUsageDAO{records: make(chan *models.UsageRecord, 10)},
+	}
+	fixture.chat = NewChat(providerRegistry, nil, &fakeProjectDAO{root: root}, fixture.settings, &fakeTemplateDAO{}, fixture.usage)
+	return fixture
+}
+
+func writeFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		t.Fatalf("failed to create the directory of %s (%s)", filePath, err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s (%s)", filePath, err)
+	}
+}
+
+// collect reads a chat stream to its end and returns its messages, the last one being the done message.
+func collect(t *testing.T, tokens <-chan *models.ChatResponse) []*models.ChatResponse {
+	t.Helper()
+	messages := make([]*models.ChatResponse, 0)
+	for msg := range tokens {
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Done == nil {
+		t.Fatal("the stream ended without a done message")
+	}
+	return messages
+}
+
+func content(messages []*models.ChatResponse) string {
+	sb := strings.Builder{}
+	for _, msg := range messages {
+		if msg.Content != nil {
+			sb.WriteString(*msg.Content)
+		}
+	}
+	return sb.String()
+}
+
+func chatRequest(question string) *models.ChatRequest {
+	return &models.ChatRequest{
+		Messages: []models.ChatMessage{{Role: models.ChatRoleUser, Content: question}},
+	}
+}
+
+func TestChatStreamsTheReplyAndRecordsTheUsage(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{Content: "Hello there!"}}}, "")
+
+	request := chatRequest("Say hello.")
+	request.ProjectId = ptr.Of(testProjectId)
+	tokens, status, err := fixture.chat.stream(context.Background(), request)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("unexpected status %d and error %v", status, err)
+	}
+	messages := collect(t, tokens)
+	if text := content(messages); text != "Hello there!" {
+		t.Fatalf("unexpected reply %q", text)
+	}
+
+	select {
+	case record := <-fixture.usage.records:
+		if record.ProjectId == nil || *record.ProjectId != testProjectId || record.Provider != config.ProviderFake || record.Model != testModel {
+			t.Fatalf("unexpected usage record %+v", record)
+		}
+		if record.PromptTokens == 0 || record.CompletionTokens == 0 || record.Cost == 0 {
+			t.Fatalf("expected the tokens and the cost to be recorded, got %+v", record)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the usage was not recorded")
+	}
+}
+
+func TestChatReportsStreamErrors(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{Content: "It failed here", StreamError: "connection reset", ErrorAfterTokens: 2}}}, "")
+
+	tokens, _, err := fixture.chat.stream(context.Background(), chatRequest("Go."))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	messages := collect(t, tokens)
+	done := messages[len(messages)-1]
+	if done.Error == nil || *done.Error != "connection reset" {
+		t.Fatalf("expected the stream error, got %v", done.Error)
+	}
+	if text := content(messages); text != "It failed " {
+		t.Fatalf("unexpected partial reply %q", text)
+	}
+}
+
+func TestChatRefusesConnectErrorsAndSpentBudgets(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{Match: "unreachable", ConnectError: "connection refused"}}}, "")
+
+	if _, _, err := fixture.chat.stream(context.Background(), chatRequest("Is it unreachable?")); err == nil || err.Error() != "connection refused" {
+		t.Fatalf("expected the connect error, got %v", err)
+	}
+
+	fixture.settings.settings = &models.ProjectSettings{MonthlyBudget: ptr.Of(1.0)}
+	fixture.usage.spent = 2
+	request := chatRequest("Say hello.")
+	request.ProjectId = ptr.Of(testProjectId)
+	var budget *budgetError
+	if _, _, err := fixture.chat.stream(context.Background(), request); !errors.As(err, &budget) {
+		t.Fatalf("expected a budget error, got %v", err)
+	}
+}
+
+func TestChatPatchModeValidatesThePatches(t *testing.T) {
+	diff := strings.Join([]string{
+		"```diff",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -3,2 +3,3 @@",
+		" func main() {",
+		"+\tprintln(\"hello\")",
+		" }",
+		"--- a/missing.go",
+		"+++ b/missing.go",
+		"@@ -1 +1 @@",
+		"-package missing",
+		"+package found",
+		"```",
+	}, "\n")
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{Content: diff}}}, "")
+
+	request := chatRequest("Print hello.")
+	request.ProjectId = ptr.Of(testProjectId)
+	request.Mode = ptr.Of(models.ChatModePatch)
+	tokens, _, err := fixture.chat.stream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	messages := collect(t, tokens)
+	patches := messages[len(messages)-1].Patches
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %d", len(patches))
+	}
+	if patches[0].Path != "main.go" || !patches[0].Valid || patches[0].BaseHash == "" {
+		t.Fatalf("expected a valid patch of main.go, got %+v", patches[0])
+	}
+	if patches[1].Path != "missing.go" || patches[1].Valid || len(patches[1].Errors) == 0 {
+		t.Fatalf("expected an invalid patch of missing.go, got %+v", patches[1])
+	}
+}
+
+func TestChatAgentModeCallsTheScriptedTools(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{
+		Content:   "main does nothing.",
+		ToolCalls: []*fake.ToolCall{{Name: "read_file", Arguments: json.RawMessage(`{"path":"main.go"}`)}},
+	}}}, "")
+
+	request := chatRequest("What does main do?")
+	request.ProjectId = ptr.Of(testProjectId)
+	request.Mode = ptr.Of(models.ChatModeAgent)
+	tokens, _, err := fixture.chat.stream(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	messages := collect(t, tokens)
+
+	var toolResult *models.ChatToolResult
+	for _, msg := range messages {
+		if msg.ToolResult != nil {
+			toolResult = msg.ToolResult
+		}
+	}
+	if toolResult == nil || toolResult.Name != "read_file" || !strings.Contains(toolResult.Output, "func main()") {
+		t.Fatalf("expected the result of read_file, got %+v", toolResult)
+	}
+	done := messages[len(messages)-1]
+	if done.Error != nil {
+		t.Fatalf("unexpected error: %s", *done.Error)
+	}
+	if text := content(messages); text != "main does nothing." {
+		t.Fatalf("unexpected reply %q", text)
+	}
+	if done.Usage == nil || done.Usage.PromptTokens == 0 {
+		t.Fatalf("expected the usage of the steps, got %+v", done.Usage)
+	}
+}
+
+func TestChatReplayIsNotCharged(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{Responses: []*fake.Response{{Content: "Hello again."}}}, cassette.ModeReplay)
+
+	tokens, _, err := fixture.chat.stream(context.Background(), chatRequest("Say hello."))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	messages := collect(t, tokens)
+	if messages[len(messages)-1].Usage == nil {
+		t.Fatal("expected the usage to be reported")
+	}
+	select {
+	case record := <-fixture.usage.records:
+		t.Fatalf("expected the replayed chat not to be recorded, got %+v", record)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestChatRejectsInvalidModes(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{}, "")
+
+	testCases := []struct {
+		name      string
+		mode      string
+		projectId *int
+	}{
+		{
+			name:      "unknown mode",
+			mode:      "telepathy",
+			projectId: ptr.Of(testProjectId),
+		},
+		{
+			name: "mode without a project",
+			mode: models.ChatModeAgent,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := chatRequest("Go.")
+			request.Mode = ptr.Of(testCase.mode)
+			request.ProjectId = testCase.projectId
+			var validation *ai.ValidationError
+			if _, _, err := fixture.chat.stream(context.Background(), request); !errors.As(err, &validation) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChatTemplates(t *testing.T) {
+	fixture := newChatFixture(t, &fake.Script{}, "")
+
+	testCases := []struct {
+		name      string
+		template  *models.ChatTemplate
+		reply     string
+		errorText string
+	}{
+		{
+			name:     "rendered template",
+			template: &models.ChatTemplate{Name: ptr.Of("greet"), Variables: map[string]string{"name": "Ada"}},
+			reply:    "This is a fake reply to: Say hello to Ada.",
+		},
+		{
+			name:      "neither ID nor name",
+			template:  &models.ChatTemplate{},
+			errorText: "needs an ID or a name",
+		},
+		{
+			name:      "unknown variable",
+			template:  &models.ChatTemplate{Name: ptr.Of("greet"), Variables: map[string]string{"name": "Ada", "age": "36"}},
+			errorText: "has no variable {{age}}",
+		},
+		{
+			name:      "missing value",
+			template:  &models.ChatTemplate{Name: ptr.Of("greet")},
+			errorText: "no value for the variables name",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := &models.ChatRequest{Template: testCase.template}
+			tokens, _, err := fixture.chat.stream(context.Background(), request)
+			if testCase.errorText != "" {
+				var validation *ai.ValidationError
+				if !errors.As(err, &validation) || !strings.Contains(err.Error(), testCase.errorText) {
+					t.Fatalf("expected a validation error containing %q, got %v", testCase.errorText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if text := content(collect(t, tokens)); text != testCase.reply {
+				t.Fatalf("unexpected reply %q", text)
+			}
+		})
+	}
+}
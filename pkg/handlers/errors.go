@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/registry"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/fulltext"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+)
+
+// The errors caused by the content of a request are answered with their message and a client error status instead of
+// an internal server error.
+func init() {
+	responders.MustRegisterErrorResponse(http.StatusBadRequest, func(err *amalgam.OptionsError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusBadRequest, func(err *ai.ValidationError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusBadRequest, func(err *registry.SelectionError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusRequestEntityTooLarge, func(err *ai.ContextWindowError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusPaymentRequired, func(err *budgetError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusForbidden, func(err *builtInTemplateError) string {
+		return err.Error()
+	})
+	responders.MustRegisterErrorResponse(http.StatusNotImplemented, func(err *fulltext.DisabledError) string {
+		return err.Error()
+	})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/CodebaseAI/pkg/watcher"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+	"github.com/TriangleSide/GoTools/pkg/ptr"
+)
+
+const (
+	// eventsKeepAliveInterval is how often a comment is sent on an idle event stream so that proxies keep it open.
+	eventsKeepAliveInterval = 30 * time.Second
+)
+
+type Events struct {
+	projectDAO     projects.DAO
+	watcherManager watcher.Manager
+}
+
+func NewEvents(projectDAO projects.DAO, watcherManager watcher.Manager) *Events {
+	return &Events{
+		projectDAO:     projectDAO,
+		watcherManager: watcherManager,
+	}
+}
+
+// Stream sends the change events of a project as Server-Sent Events until the client disconnects.
+func (e *Events) Stream(w http.ResponseWriter, r *http.Request) {
+	projectId, err := strconv.Atoi(r.PathValue("projectId"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid project ID (%s)", err.Error()), http.StatusBadRequest)
+		return
+	}
+	if err := e.projectDAO.Get(r.Context(), &models.Project{Id: ptr.Of(projectId)}); err != nil {
+		logger.Errorf("Failed to get project (%s).", err.Error())
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := e.watcherManager.Subscribe(projectId)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.Errorf("Failed to encode project event (%s).", err.Error())
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (e *Events) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathProjectEvents, http.MethodOptions, nil)
+	builder.MustRegister(api.PathProjectEvents, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    e.Stream,
+	})
+}
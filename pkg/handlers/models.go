@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/registry"
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+type Models struct {
+	registry *registry.Registry
+}
+
+func NewModels(registry *registry.Registry) *Models {
+	return &Models{
+		registry: registry,
+	}
+}
+
+func (m *Models) List(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.ListModelsRequest) (*models.ListModelsResponse, int, error) {
+		return &models.ListModelsResponse{
+			Models: m.registry.Models(),
+		}, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (m *Models) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathModels, http.MethodOptions, nil)
+	builder.MustRegister(api.PathModels, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    m.List,
+	})
+}
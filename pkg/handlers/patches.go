@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/patches"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/CodebaseAI/pkg/patch"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+type Patches struct {
+	projectDAO projects.DAO
+	patchDAO   patches.DAO
+
+	// lock serializes the changes to the files, so the checks of a patch set still hold when it is written.
+	lock sync.Mutex
+}
+
+func NewPatches(projectDAO projects.DAO, patchDAO patches.DAO) *Patches {
+	return &Patches{
+		projectDAO: projectDAO,
+		patchDAO:   patchDAO,
+	}
+}
+
+func (p *Patches) DryRun(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.PatchesRequest) (*models.DryRunPatchesResponse, int, error) {
+		project, err := p.project(r.Context(), requestParameters.ProjectId)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes, results := patch.Prepare(*project.Path, requestParameters.Patches)
+		return &models.DryRunPatchesResponse{
+			Applicable: changes != nil,
+			Files:      results,
+		}, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (p *Patches) Apply(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.PatchesRequest) (*models.PatchSet, int, error) {
+		project, err := p.project(r.Context(), requestParameters.ProjectId)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		changes, results := patch.Prepare(*project.Path, requestParameters.Patches)
+		if changes == nil {
+			return &models.PatchSet{ProjectId: project.Id, Results: results}, http.StatusConflict, nil
+		}
+
+		patchSet := &models.PatchSet{
+			ProjectId: project.Id,
+			Files:     make([]*models.PatchSetFile, 0, len(changes)),
+		}
+		for _, change := range changes {
+			file := &models.PatchSetFile{
+				Path:      change.Path,
+				Operation: change.Operation,
+				Backup:    change.Before,
+			}
+			if change.Before != nil {
+				file.BaseHash = patch.Hash(change.Before)
+			}
+			if change.After != nil {
+				file.AppliedHash = patch.Hash(change.After)
+			}
+			patchSet.Files = append(patchSet.Files, file)
+		}
+
+		// The backups are stored before the files are written, so a patch set can always be reverted.
+		if err := p.patchDAO.Create(r.Context(), patchSet); err != nil {
+			return nil, 0, err
+		}
+		if err := patch.Write(changes); err != nil {
+			if deleteErr := p.patchDAO.Delete(context.WithoutCancel(r.Context()), patchSet); deleteErr != nil {
+				logger.Errorf("Failed to delete the patch set that could not be applied (%s).", deleteErr.Error())
+			}
+			return nil, 0, err
+		}
+
+		if err := p.patchDAO.Get(r.Context(), patchSet); err != nil {
+			return nil, 0, err
+		}
+		return patchSet, http.StatusCreated, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (p *Patches) List(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.ListPatchSetsRequest) (*models.ListPatchSetsResponse, int, error) {
+		if _, err := p.project(r.Context(), requestParameters.ProjectId); err != nil {
+			return nil, 0, err
+		}
+		patchSets, err := p.patchDAO.List(r.Context(), &patches.ListParameters{
+			ProjectId: *requestParameters.ProjectId,
+			Limit:     requestParameters.Limit,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		return &models.ListPatchSetsResponse{
+			PatchSets: patchSets,
+		}, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (p *Patches) Revert(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.RevertPatchSetRequest) (*models.PatchSet, int, error) {
+		project, err := p.project(r.Context(), requestParameters.ProjectId)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		patchSet := &models.PatchSet{
+			Id:        requestParameters.Id,
+			ProjectId: project.Id,
+		}
+		if err := p.patchDAO.Get(r.Context(), patchSet); err != nil {
+			return nil, 0, err
+		}
+		// A patch set that was already reverted is answered as it is, with the time of its revert.
+		if patchSet.RevertTime != nil {
+			return patchSet, http.StatusConflict, nil
+		}
+
+		changes, results := patch.Revert(*project.Path, patchSet)
+		if changes == nil {
+			patchSet.Results = results
+			return patchSet, http.StatusConflict, nil
+		}
+		if err := patch.Write(changes); err != nil {
+			return nil, 0, err
+		}
+		if _, err := p.patchDAO.MarkReverted(context.WithoutCancel(r.Context()), patchSet); err != nil {
+			return nil, 0, err
+		}
+
+		if err := p.patchDAO.Get(r.Context(), patchSet); err != nil {
+			return nil, 0, err
+		}
+		return patchSet, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+// project returns the project with the given ID.
+func (p *Patches) project(ctx context.Context, projectId *int) (*models.Project, error) {
+	project := &models.Project{
+		Id: projectId,
+	}
+	if err := p.projectDAO.Get(ctx, project); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+func (p *Patches) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathProjectPatches, http.MethodOptions, nil)
+	builder.MustRegister(api.PathProjectPatches, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.List,
+	})
+	builder.MustRegister(api.PathProjectPatches, http.MethodPost, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.Apply,
+	})
+
+	builder.MustRegister(api.PathPatchesDryRun, http.MethodOptions, nil)
+	builder.MustRegister(api.PathPatchesDryRun, http.MethodPost, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.DryRun,
+	})
+
+	builder.MustRegister(api.PathPatchSetRevert, http.MethodOptions, nil)
+	builder.MustRegister(api.PathPatchSetRevert, http.MethodPost, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.Revert,
+	})
+}
@@ -5,19 +5,25 @@ import (
 
 	"github.com/TriangleSide/CodebaseAI/pkg/api"
 	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/fulltext"
 	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/CodebaseAI/pkg/watcher"
 	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
 	"github.com/TriangleSide/GoTools/pkg/http/responders"
 	"github.com/TriangleSide/GoTools/pkg/logger"
 )
 
 type Project struct {
-	projectDAO projects.DAO
+	projectDAO     projects.DAO
+	searchIndex    *fulltext.Index
+	watcherManager watcher.Manager
 }
 
-func NewProject(projectDAO projects.DAO) *Project {
+func NewProject(projectDAO projects.DAO, searchIndex *fulltext.Index, watcherManager watcher.Manager) *Project {
 	return &Project{
-		projectDAO: projectDAO,
+		projectDAO:     projectDAO,
+		searchIndex:    searchIndex,
+		watcherManager: watcherManager,
 	}
 }
 
@@ -60,6 +66,9 @@ func (p *Project) Create(w http.ResponseWriter, r *http.Request) {
 		if err := p.projectDAO.Create(r.Context(), project); err != nil {
 			return nil, 0, err
 		}
+		if err := p.watcherManager.Watch(*project.Id, *project.Path); err != nil {
+			logger.Errorf("Failed to watch the new project (%s).", err.Error())
+		}
 		return project, http.StatusAccepted, nil
 	}, responders.WithErrorCallback(func(err error) {
 		logger.Errorf("Error while handling request (%s).", err.Error())
@@ -75,6 +84,10 @@ func (p *Project) Delete(w http.ResponseWriter, r *http.Request) {
 			return 0, err
 		}
 		if deleted {
+			p.watcherManager.Unwatch(*requestParameters.Id)
+			if err := p.searchIndex.Remove(r.Context(), *requestParameters.Id); err != nil {
+				return 0, err
+			}
 			return http.StatusOK, nil
 		} else {
 			return http.StatusNoContent, nil
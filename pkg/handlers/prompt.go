@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam/language"
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+type Prompt struct {
+	projectDAO  projects.DAO
+	settingsDAO settings.DAO
+}
+
+func NewPrompt(projectDAO projects.DAO, settingsDAO settings.DAO) *Prompt {
+	return &Prompt{
+		projectDAO:  projectDAO,
+		settingsDAO: settingsDAO,
+	}
+}
+
+func (p *Prompt) Get(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.GetProjectPromptRequest) (*models.ProjectPrompt, int, error) {
+		project, projectSettings, err := p.load(r.Context(), requestParameters.Id)
+		if err != nil {
+			return nil, 0, err
+		}
+		response, err := projectPrompt(r.Context(), project, projectSettings)
+		if err != nil {
+			return nil, 0, err
+		}
+		return response, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (p *Prompt) Update(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.UpdateProjectPromptRequest) (*models.ProjectPrompt, int, error) {
+		project, projectSettings, err := p.load(r.Context(), requestParameters.Id)
+		if err != nil {
+			return nil, 0, err
+		}
+		// An empty prompt goes back to the default instructions.
+		projectSettings.SystemPrompt = nil
+		if requestParameters.Prompt != nil && strings.TrimSpace(*requestParameters.Prompt) != "" {
+			if err := ai.ValidateTemplate(*requestParameters.Prompt, ai.PromptVariables); err != nil {
+				return nil, 0, err
+			}
+			projectSettings.SystemPrompt = requestParameters.Prompt
+		}
+		if err := p.settingsDAO.Upsert(r.Context(), projectSettings); err != nil {
+			return nil, 0, err
+		}
+		response, err := projectPrompt(r.Context(), project, projectSettings)
+		if err != nil {
+			return nil, 0, err
+		}
+		return response, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+// load returns the project with the given ID and its settings.
+func (p *Prompt) load(ctx context.Context, projectId *int) (*models.Project, *models.ProjectSettings, error) {
+	project := &models.Project{
+		Id: projectId,
+	}
+	if err := p.projectDAO.Get(ctx, project); err != nil {
+		return nil, nil, err
+	}
+	projectSettings := &models.ProjectSettings{
+		ProjectId: projectId,
+	}
+	if err := p.settingsDAO.Get(ctx, projectSettings); err != nil {
+		return nil, nil, err
+	}
+	return project, projectSettings, nil
+}
+
+func (p *Prompt) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathProjectPrompt, http.MethodOptions, nil)
+	builder.MustRegister(api.PathProjectPrompt, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.Get,
+	})
+	builder.MustRegister(api.PathProjectPrompt, http.MethodPut, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    p.Update,
+	})
+}
+
+// projectPrompt returns the system prompt of the project, resolved with the amalgam options of its settings.
+func projectPrompt(ctx context.Context, project *models.Project, projectSettings *models.ProjectSettings) (*models.ProjectPrompt, error) {
+	response := &models.ProjectPrompt{
+		ProjectId: project.Id,
+		Prompt:    ai.Instructions,
+		Default:   projectSettings.SystemPrompt == nil,
+		Variables: ai.PromptVariables,
+	}
+	if projectSettings.SystemPrompt != nil {
+		response.Prompt = *projectSettings.SystemPrompt
+	}
+	options := &models.AmalgamOptions{
+		ExcludeGenerated: projectSettings.ExcludeGenerated,
+		ExcludeVendored:  projectSettings.ExcludeVendored,
+		ExcludeLockFiles: projectSettings.ExcludeLockFiles,
+	}
+	resolved, err := resolvePrompt(ctx, response.Prompt, project, options)
+	if err != nil {
+		return nil, err
+	}
+	response.Resolved = resolved
+	return response, nil
+}
+
+// resolvePrompt replaces the variables of a system prompt with the values of the project. The languages are only
+// detected when the prompt uses them, since it needs the amalgam of the project.
+func resolvePrompt(ctx context.Context, prompt string, project *models.Project, options *models.AmalgamOptions) (string, error) {
+	values := map[string]string{
+		ai.PromptVariableProjectName: filepath.Base(*project.Path),
+		ai.PromptVariableDate:        time.Now().Format(time.DateOnly),
+	}
+	if slices.Contains(ai.TemplateVariables(prompt), ai.PromptVariableLanguages) {
+		languages, err := projectLanguages(ctx, project, options)
+		if err != nil {
+			return "", err
+		}
+		values[ai.PromptVariableLanguages] = strings.Join(languages, ", ")
+	}
+	return ai.RenderTemplate(prompt, values)
+}
+
+// projectLanguages returns the languages of the files in the amalgam of the project, the most used first. The files
+// are listed without building the amalgam, and only the files whose path does not tell their language are read.
+func projectLanguages(ctx context.Context, project *models.Project, options *models.AmalgamOptions) ([]string, error) {
+	files, err := amalgam.List(ctx, *project.Path, options)
+	if err != nil {
+		logger.Errorf("Failed to list the project files (%s).", err.Error())
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, file := range files {
+		fileLanguage, err := language.DetectFile(filepath.Join(*project.Path, filepath.FromSlash(file.Path)))
+		if err != nil {
+			logger.Debugf("Failed to detect the language of %s (%s).", file.Path, err.Error())
+			continue
+		}
+		if fileLanguage != "" {
+			counts[fileLanguage]++
+		}
+	}
+	languages := make([]string, 0, len(counts))
+	for language := range counts {
+		languages = append(languages, language)
+	}
+	slices.SortFunc(languages, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	return languages, nil
+}
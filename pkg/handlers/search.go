@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/fulltext"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+type Search struct {
+	projectDAO  projects.DAO
+	settingsDAO settings.DAO
+	searchIndex *fulltext.Index
+}
+
+func NewSearch(projectDAO projects.DAO, settingsDAO settings.DAO, searchIndex *fulltext.Index) *Search {
+	return &Search{
+		projectDAO:  projectDAO,
+		settingsDAO: settingsDAO,
+		searchIndex: searchIndex,
+	}
+}
+
+// Get updates the search index of the project with the files that changed and returns the chunks that match the query.
+func (s *Search) Get(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.SearchRequest) (*models.SearchResponse, int, error) {
+		project := &models.Project{
+			Id: requestParameters.ProjectId,
+		}
+		if err := s.projectDAO.Get(r.Context(), project); err != nil {
+			logger.Errorf("Failed to get project (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		projectSettings := &models.ProjectSettings{
+			ProjectId: project.Id,
+		}
+		if err := s.settingsDAO.Get(r.Context(), projectSettings); err != nil {
+			logger.Errorf("Failed to get project settings (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		options := &models.AmalgamOptions{
+			ExcludeGenerated: projectSettings.ExcludeGenerated,
+			ExcludeVendored:  projectSettings.ExcludeVendored,
+			ExcludeLockFiles: projectSettings.ExcludeLockFiles,
+		}
+		if err := s.searchIndex.Update(r.Context(), *project.Id, *project.Path, options); err != nil {
+			logger.Errorf("Failed to update the search index (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		results, err := s.searchIndex.Search(r.Context(), *project.Id, *requestParameters.Query, requestParameters.Limit)
+		if err != nil {
+			logger.Errorf("Failed to search the project (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		return &models.SearchResponse{Results: results}, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (s *Search) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathProjectSearch, http.MethodOptions, nil)
+	builder.MustRegister(api.PathProjectSearch, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    s.Get,
+	})
+}
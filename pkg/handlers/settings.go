@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/projects"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/settings"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+type Settings struct {
+	projectDAO  projects.DAO
+	settingsDAO settings.DAO
+}
+
+func NewSettings(projectDAO projects.DAO, settingsDAO settings.DAO) *Settings {
+	return &Settings{
+		projectDAO:  projectDAO,
+		settingsDAO: settingsDAO,
+	}
+}
+
+func (s *Settings) Get(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.GetProjectSettingsRequest) (*models.ProjectSettings, int, error) {
+		if err := s.projectDAO.Get(r.Context(), &models.Project{Id: requestParameters.Id}); err != nil {
+			return nil, 0, err
+		}
+		projectSettings := &models.ProjectSettings{
+			ProjectId: requestParameters.Id,
+		}
+		if err := s.settingsDAO.Get(r.Context(), projectSettings); err != nil {
+			return nil, 0, err
+		}
+		return projectSettings, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (s *Settings) Update(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.UpdateProjectSettingsRequest) (*models.ProjectSettings, int, error) {
+		if err := s.projectDAO.Get(r.Context(), &models.Project{Id: requestParameters.Id}); err != nil {
+			return nil, 0, err
+		}
+		projectSettings := &models.ProjectSettings{
+			ProjectId: requestParameters.Id,
+		}
+		if err := s.settingsDAO.Get(r.Context(), projectSettings); err != nil {
+			return nil, 0, err
+		}
+		if requestParameters.ExcludeGenerated != nil {
+			projectSettings.ExcludeGenerated = requestParameters.ExcludeGenerated
+		}
+		if requestParameters.ExcludeVendored != nil {
+			projectSettings.ExcludeVendored = requestParameters.ExcludeVendored
+		}
+		if requestParameters.ExcludeLockFiles != nil {
+			projectSettings.ExcludeLockFiles = requestParameters.ExcludeLockFiles
+		}
+		// The generation defaults are replaced as a whole. An empty object clears them, which stores NULL.
+		if requestParameters.Generation != nil {
+			if err := ai.ValidateGeneration(requestParameters.Generation); err != nil {
+				return nil, 0, err
+			}
+			projectSettings.Generation = requestParameters.Generation
+			if ai.EmptyGeneration(requestParameters.Generation) {
+				projectSettings.Generation = nil
+			}
+		}
+		// A budget of zero or less removes the budget.
+		if requestParameters.MonthlyBudget != nil {
+			projectSettings.MonthlyBudget = nil
+			if *requestParameters.MonthlyBudget > 0 {
+				projectSettings.MonthlyBudget = requestParameters.MonthlyBudget
+			}
+		}
+		if err := s.settingsDAO.Upsert(r.Context(), projectSettings); err != nil {
+			return nil, 0, err
+		}
+		return projectSettings, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (s *Settings) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathProjectSettings, http.MethodOptions, nil)
+	builder.MustRegister(api.PathProjectSettings, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    s.Get,
+	})
+	builder.MustRegister(api.PathProjectSettings, http.MethodPut, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    s.Update,
+	})
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/templates"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+// builtInTemplateError is returned when a request would change a template that ships with the server.
+type builtInTemplateError struct {
+	name string
+}
+
+func (e *builtInTemplateError) Error() string {
+	return fmt.Sprintf("the template '%s' is built in and cannot be changed, create a copy instead", e.name)
+}
+
+type Templates struct {
+	templateDAO templates.DAO
+}
+
+func NewTemplates(templateDAO templates.DAO) *Templates {
+	return &Templates{
+		templateDAO: templateDAO,
+	}
+}
+
+func (t *Templates) Get(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.GetPromptTemplateRequest) (*models.PromptTemplate, int, error) {
+		template := &models.PromptTemplate{
+			Id: requestParameters.Id,
+		}
+		if err := t.templateDAO.Get(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		template.Variables = ai.TemplateVariables(*template.Content)
+		return template, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (t *Templates) List(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.ListPromptTemplatesRequest) (*models.ListPromptTemplatesResponse, int, error) {
+		templateList, err := t.templateDAO.List(r.Context(), &templates.ListParameters{
+			Limit: requestParameters.Limit,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, template := range templateList {
+			template.Variables = ai.TemplateVariables(*template.Content)
+		}
+		return &models.ListPromptTemplatesResponse{
+			Templates: templateList,
+		}, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (t *Templates) Create(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.CreatePromptTemplateRequest) (*models.PromptTemplate, int, error) {
+		template := &models.PromptTemplate{
+			Name:        &requestParameters.Name,
+			Description: &requestParameters.Description,
+			Content:     &requestParameters.Content,
+		}
+		if err := t.templateDAO.Create(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		if err := t.templateDAO.Get(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		template.Variables = ai.TemplateVariables(*template.Content)
+		return template, http.StatusCreated, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (t *Templates) Update(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.UpdatePromptTemplateRequest) (*models.PromptTemplate, int, error) {
+		template := &models.PromptTemplate{
+			Id: requestParameters.Id,
+		}
+		if err := t.templateDAO.Get(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		if *template.BuiltIn {
+			return nil, 0, &builtInTemplateError{name: *template.Name}
+		}
+		if requestParameters.Name != nil && *requestParameters.Name != "" {
+			template.Name = requestParameters.Name
+		}
+		if requestParameters.Description != nil {
+			template.Description = requestParameters.Description
+		}
+		if requestParameters.Content != nil && *requestParameters.Content != "" {
+			template.Content = requestParameters.Content
+		}
+		if _, err := t.templateDAO.Update(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		if err := t.templateDAO.Get(r.Context(), template); err != nil {
+			return nil, 0, err
+		}
+		template.Variables = ai.TemplateVariables(*template.Content)
+		return template, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (t *Templates) Delete(w http.ResponseWriter, r *http.Request) {
+	responders.Status(w, r, func(requestParameters *models.DeletePromptTemplateRequest) (int, error) {
+		template := &models.PromptTemplate{
+			Id: requestParameters.Id,
+		}
+		deleted, err := t.templateDAO.Delete(r.Context(), template)
+		if err != nil {
+			return 0, err
+		}
+		if deleted {
+			return http.StatusOK, nil
+		}
+		// The built-in templates are never deleted, tell them apart from the templates that do not exist.
+		if err := t.templateDAO.Get(r.Context(), template); err == nil && *template.BuiltIn {
+			return 0, &builtInTemplateError{name: *template.Name}
+		}
+		return http.StatusNoContent, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+func (t *Templates) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathTemplates, http.MethodOptions, nil)
+	builder.MustRegister(api.PathTemplates, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    t.List,
+	})
+	builder.MustRegister(api.PathTemplates, http.MethodPost, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    t.Create,
+	})
+
+	builder.MustRegister(api.PathTemplateId, http.MethodOptions, nil)
+	builder.MustRegister(api.PathTemplateId, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    t.Get,
+	})
+	builder.MustRegister(api.PathTemplateId, http.MethodPut, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    t.Update,
+	})
+	builder.MustRegister(api.PathTemplateId, http.MethodDelete, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    t.Delete,
+	})
+}
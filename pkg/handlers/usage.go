@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/api"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/usage"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	baseapi "github.com/TriangleSide/GoTools/pkg/http/api"
+	"github.com/TriangleSide/GoTools/pkg/http/responders"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	// defaultUsageDays is the length of the period reported when the request has no start date.
+	defaultUsageDays = 30
+)
+
+type Usage struct {
+	usageDAO usage.DAO
+}
+
+func NewUsage(usageDAO usage.DAO) *Usage {
+	return &Usage{
+		usageDAO: usageDAO,
+	}
+}
+
+// Get reports the usage by day, project and model. The from and to dates are inclusive, in UTC and formatted as
+// YYYY-MM-DD. They default to the last 30 days.
+func (u *Usage) Get(w http.ResponseWriter, r *http.Request) {
+	responders.JSON(w, r, func(requestParameters *models.UsageRequest) (*models.UsageResponse, int, error) {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		to, err := parseUsageDate(requestParameters.To, today)
+		if err != nil {
+			return nil, 0, err
+		}
+		from, err := parseUsageDate(requestParameters.From, to.AddDate(0, 0, 1-defaultUsageDays))
+		if err != nil {
+			return nil, 0, err
+		}
+		if from.After(to) {
+			return nil, 0, &ai.ValidationError{Err: fmt.Errorf("the start date %s is after the end date %s", from.Format(time.DateOnly), to.Format(time.DateOnly))}
+		}
+
+		aggregates, err := u.usageDAO.Aggregate(r.Context(), &usage.AggregateParameters{
+			ProjectId: requestParameters.ProjectId,
+			From:      from,
+			To:        to.AddDate(0, 0, 1),
+		})
+		if err != nil {
+			logger.Errorf("Failed to aggregate the usage (%s).", err.Error())
+			return nil, 0, err
+		}
+
+		response := &models.UsageResponse{
+			From:  from.Format(time.DateOnly),
+			To:    to.Format(time.DateOnly),
+			Usage: aggregates,
+		}
+		for _, aggregate := range aggregates {
+			response.TotalCost += aggregate.Cost
+		}
+		return response, http.StatusOK, nil
+	}, responders.WithErrorCallback(func(err error) {
+		logger.Errorf("Error while handling request (%s).", err.Error())
+	}))
+}
+
+// parseUsageDate parses a date of the request, or returns the default when it is not set. The error is an
+// *ai.ValidationError.
+func parseUsageDate(value *string, defaultValue time.Time) (time.Time, error) {
+	if value == nil {
+		return defaultValue, nil
+	}
+	date, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		return time.Time{}, &ai.ValidationError{Err: fmt.Errorf("invalid date '%s', expected YYYY-MM-DD (%w)", *value, err)}
+	}
+	return date, nil
+}
+
+func (u *Usage) AcceptHTTPAPIBuilder(builder *baseapi.HTTPAPIBuilder) {
+	builder.MustRegister(api.PathUsage, http.MethodOptions, nil)
+	builder.MustRegister(api.PathUsage, http.MethodGet, &baseapi.Handler{
+		Middleware: nil,
+		Handler:    u.Get,
+	})
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	encodingZstd = "zstd"
+	encodingGzip = "gzip"
+)
+
+// Compress encodes the response body with zstd or gzip when the client accepts it. Zstd is preferred when both are
+// accepted with the same quality.
+func Compress(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer func() {
+			if err := cw.close(); err != nil {
+				logger.Errorf("Failed to close the %s encoder (%s).", encoding, err.Error())
+			}
+		}()
+		next.ServeHTTP(cw, r)
+	}
+}
+
+// negotiateEncoding picks the encoding with the highest quality value from an Accept-Encoding header. It returns an
+// empty string if neither zstd nor gzip is acceptable.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		qualities[name] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range []string{encodingZstd, encodingGzip} {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter creates the encoder once the status is known, so responses without a body are left untouched.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     io.WriteCloser
+	wroteHeader bool
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified && c.Header().Get("Content-Encoding") == "" {
+		c.Header().Set("Content-Encoding", c.encoding)
+		c.Header().Del("Content-Length")
+		switch c.encoding {
+		case encodingZstd:
+			encoder, err := zstd.NewWriter(c.ResponseWriter, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				logger.Errorf("Failed to create the zstd encoder (%s).", err.Error())
+				c.Header().Del("Content-Encoding")
+				break
+			}
+			c.encoder = encoder
+		case encodingGzip:
+			c.encoder = gzip.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.encoder == nil {
+		return c.ResponseWriter.Write(b)
+	}
+	return c.encoder.Write(b)
+}
+
+func (c *compressWriter) Flush() {
+	if flusher, ok := c.encoder.(interface{ Flush() error }); ok {
+		if err := flusher.Flush(); err != nil {
+			logger.Errorf("Failed to flush the %s encoder (%s).", c.encoding, err.Error())
+		}
+	}
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (c *compressWriter) close() error {
+	if c.encoder == nil {
+		return nil
+	}
+	return c.encoder.Close()
+}
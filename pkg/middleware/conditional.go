@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ConditionalGet answers a GET with 304 Not Modified when the ETag set by the handler matches the If-None-Match
+// header of the request. The body written by the handler is discarded in that case.
+func ConditionalGet(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch := r.Header.Get("If-None-Match")
+		if ifNoneMatch == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&conditionalWriter{ResponseWriter: w, ifNoneMatch: ifNoneMatch}, r)
+	}
+}
+
+// conditionalWriter replaces a successful response by 304 Not Modified if its ETag matches.
+type conditionalWriter struct {
+	http.ResponseWriter
+	ifNoneMatch string
+	wroteHeader bool
+	notModified bool
+}
+
+func (c *conditionalWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	if status == http.StatusOK && etagMatches(c.ifNoneMatch, c.Header().Get("ETag")) {
+		c.notModified = true
+		c.Header().Del("Content-Type")
+		c.Header().Del("Content-Length")
+		c.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *conditionalWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.notModified {
+		return len(b), nil
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *conditionalWriter) Flush() {
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok && !c.notModified {
+		flusher.Flush()
+	}
+}
+
+// etagMatches applies the weak comparison of RFC 9110 between an If-None-Match header and an ETag.
+func etagMatches(ifNoneMatch string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,59 @@
 package models
 
+type AmalgamOptions struct {
+	Include          []string `json:"include,omitempty"`
+	Exclude          []string `json:"exclude,omitempty"`
+	IncludeTests     *bool    `json:"includeTests,omitempty"`
+	ExcludeGenerated *bool    `json:"excludeGenerated,omitempty"`
+	ExcludeVendored  *bool    `json:"excludeVendored,omitempty"`
+	ExcludeLockFiles *bool    `json:"excludeLockFiles,omitempty"`
+}
+
 type AmalgamRequest struct {
-	ProjectId int `urlPath:"projectId" json:"-"`
+	ProjectId    int     `urlPath:"projectId" json:"-"`
+	Include      *string `urlQuery:"include" json:"-"`
+	Exclude      *string `urlQuery:"exclude" json:"-"`
+	IncludeTests *bool   `urlQuery:"includeTests" json:"-"`
+}
+
+type AmalgamFile struct {
+	Path      string `json:"path"`
+	Language  string `json:"language,omitempty"`
+	Encoding  string `json:"encoding,omitempty"`
+	Converted bool   `json:"converted,omitempty"`
+	Hash      string `json:"hash"`
+}
+
+type AmalgamFileError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type AmalgamExclusions struct {
+	Generated           int                 `json:"generated"`
+	VendoredDirectories int                 `json:"vendoredDirectories"`
+	LockFiles           int                 `json:"lockFiles"`
+	Unparsable          []*AmalgamFileError `json:"unparsable"`
 }
 
 type AmalgamResponse struct {
-	Content    string `json:"content"`
-	TokenCount int    `json:"tokenCount"`
+	Hash       string             `json:"hash"`
+	Content    string             `json:"content"`
+	TokenCount int                `json:"tokenCount"`
+	Files      []*AmalgamFile     `json:"files"`
+	Excluded   *AmalgamExclusions `json:"excluded"`
+}
+
+type AmalgamExplainEntry struct {
+	Path      string `json:"path"`
+	Directory bool   `json:"directory,omitempty"`
+	Included  bool   `json:"included"`
+	Rule      string `json:"rule"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+type AmalgamExplainResponse struct {
+	Entries       []*AmalgamExplainEntry `json:"entries"`
+	IncludedCount int                    `json:"includedCount"`
+	ExcludedCount int                    `json:"excludedCount"`
 }
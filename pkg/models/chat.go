@@ -1,16 +1,100 @@
 package models
 
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+const (
+	// ChatModeAgent lets the model read the files of the project with tools instead of receiving the whole codebase.
+	ChatModeAgent = "agent"
+
+	// ChatModeRetrieval adds the parts of the codebase that are the most similar to the latest question, instead of
+	// the whole codebase.
+	ChatModeRetrieval = "retrieval"
+
+	// ChatModePatch asks the model to answer with unified diffs, which are parsed and validated against the files of
+	// the project.
+	ChatModePatch = "patch"
+)
+
 type ChatMessage struct {
 	Content string `json:"content"`
 	Role    string `json:"role"`
 }
 
+type GenerationOptions struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens *int     `json:"maxOutputTokens,omitempty"`
+	Stop            []string `json:"stop,omitempty"`
+	Seed            *int     `json:"seed,omitempty"`
+	ReasoningEffort *string  `json:"reasoningEffort,omitempty"`
+}
+
 type ChatRequest struct {
-	Messages []ChatMessage `json:"messages"`
+	Messages   []ChatMessage      `json:"messages"`
+	Provider   *string            `json:"provider,omitempty"`
+	Model      *string            `json:"model,omitempty"`
+	ProjectId  *int               `json:"projectId,omitempty"`
+	Amalgam    *AmalgamOptions    `json:"amalgam,omitempty"`
+	Generation *GenerationOptions `json:"generation,omitempty"`
+	Mode       *string            `json:"mode,omitempty"`
+	Template   *ChatTemplate      `json:"template,omitempty"`
+
+	// SystemPrompt is the resolved system prompt of the project, added by the server when the project has one.
+	SystemPrompt *string `json:"-"`
+
+	// Codebase is the amalgam of the project, added by the server when the request has a project ID.
+	Codebase *string `json:"-"`
+
+	// CodebaseTokenCount is the token count of the amalgam, so it does not have to be counted again.
+	CodebaseTokenCount *int `json:"-"`
+}
+
+type ChatTrimmed struct {
+	Messages int `json:"messages"`
+	Tokens   int `json:"tokens"`
+}
+
+type ChatUsage struct {
+	PromptTokens     int  `json:"promptTokens"`
+	CompletionTokens int  `json:"completionTokens"`
+	CachedTokens     int  `json:"cachedTokens"`
+	Estimated        bool `json:"estimated,omitempty"`
+}
+
+type ChatStatus struct {
+	Type        string `json:"type"`
+	Attempt     int    `json:"attempt,omitempty"`
+	MaxAttempts int    `json:"maxAttempts,omitempty"`
+	DelayMs     int    `json:"delayMs,omitempty"`
+	Message     string `json:"message,omitempty"`
+}
+
+type ChatToolCall struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ChatToolResult struct {
+	Id        string  `json:"id"`
+	Name      string  `json:"name"`
+	Output    string  `json:"output"`
+	Truncated bool    `json:"truncated,omitempty"`
+	Error     *string `json:"error,omitempty"`
 }
 
 type ChatResponse struct {
-	Content *string `json:"content,omitempty"`
-	Done    *bool   `json:"done,omitempty"`
-	Error   *string `json:"error,omitempty"`
+	Content    *string         `json:"content,omitempty"`
+	Done       *bool           `json:"done,omitempty"`
+	Error      *string         `json:"error,omitempty"`
+	Trimmed    *ChatTrimmed    `json:"trimmed,omitempty"`
+	Status     *ChatStatus     `json:"status,omitempty"`
+	Usage      *ChatUsage      `json:"usage,omitempty"`
+	ToolCall   *ChatToolCall   `json:"toolCall,omitempty"`
+	ToolResult *ChatToolResult `json:"toolResult,omitempty"`
+	Patches    []*FilePatch    `json:"patches,omitempty"`
 }
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type ProjectEvent struct {
+	Id        int       `json:"id"`
+	ProjectId int       `json:"projectId"`
+	Type      string    `json:"type"`
+	Paths     []string  `json:"paths"`
+	Truncated bool      `json:"truncated,omitempty"`
+	Time      time.Time `json:"time"`
+}
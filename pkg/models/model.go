@@ -0,0 +1,19 @@
+package models
+
+type Model struct {
+	Provider      string `json:"provider"`
+	Name          string `json:"name"`
+	ContextWindow int    `json:"contextWindow,omitempty"`
+	Default       bool   `json:"default"`
+
+	// The prices are in US dollars per million tokens.
+	InputPrice       float64 `json:"inputPrice,omitempty"`
+	CachedInputPrice float64 `json:"cachedInputPrice,omitempty"`
+	OutputPrice      float64 `json:"outputPrice,omitempty"`
+}
+
+type ListModelsRequest struct{}
+
+type ListModelsResponse struct {
+	Models []*Model `json:"models"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+const (
+	PatchOperationCreate = "create"
+	PatchOperationModify = "modify"
+	PatchOperationDelete = "delete"
+)
+
+// PatchHunk is a hunk of a unified diff. The lines keep their prefix, a space for context, a minus for a removed line
+// and a plus for an added line.
+type PatchHunk struct {
+	OldStart int      `json:"oldStart"`
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"`
+}
+
+// FilePatch is the unified diff of a file, relative to the root of the project.
+type FilePatch struct {
+	Path      string       `json:"path"`
+	Operation string       `json:"operation"`
+	Hunks     []*PatchHunk `json:"hunks"`
+
+	// BaseHash is the SHA-256 of the file the patch was validated against, empty for a new file.
+	BaseHash string   `json:"baseHash,omitempty"`
+	Valid    bool     `json:"valid"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type PatchesRequest struct {
+	ProjectId *int         `urlPath:"projectId" json:"-" validate:"required"`
+	Patches   []*FilePatch `json:"patches" validate:"required"`
+}
+
+// PatchFileResult is the outcome of checking the patch of a file against the project. A conflict means the file
+// changed since the patch was validated.
+type PatchFileResult struct {
+	Path      string   `json:"path"`
+	Operation string   `json:"operation"`
+	Conflict  bool     `json:"conflict,omitempty"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+type DryRunPatchesResponse struct {
+	Applicable bool               `json:"applicable"`
+	Files      []*PatchFileResult `json:"files"`
+}
+
+// PatchSet is a set of patches applied to a project, with the backups of the files to revert it.
+type PatchSet struct {
+	Id          *int            `json:"id"`
+	ProjectId   *int            `json:"projectId"`
+	Files       []*PatchSetFile `json:"files"`
+	CreatedTime *time.Time      `json:"createdTime"`
+	RevertTime  *time.Time      `json:"revertTime"`
+
+	// Results are the outcomes of the checks of the files when the patch set cannot be applied or reverted. They are
+	// only set on a 409 response.
+	Results []*PatchFileResult `json:"results,omitempty"`
+}
+
+// PatchSetFile is a file changed by a patch set. The hashes are empty when the file did not exist before or after.
+type PatchSetFile struct {
+	Path        string `json:"path"`
+	Operation   string `json:"operation"`
+	BaseHash    string `json:"baseHash,omitempty"`
+	AppliedHash string `json:"appliedHash,omitempty"`
+
+	// Backup is the content of the file before the patch, nil when the patch created it.
+	Backup []byte `json:"-"`
+}
+
+type ListPatchSetsRequest struct {
+	ProjectId *int `urlPath:"projectId" json:"-" validate:"required"`
+	Limit     *int `urlQuery:"limit" json:"-"`
+}
+
+type ListPatchSetsResponse struct {
+	PatchSets []*PatchSet `json:"patchSets"`
+}
+
+type RevertPatchSetRequest struct {
+	ProjectId *int `urlPath:"projectId" json:"-" validate:"required"`
+	Id        *int `urlPath:"patchSetId" json:"-" validate:"required"`
+}
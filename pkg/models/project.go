@@ -32,3 +32,28 @@ type DeleteProjectRequest struct {
 type UpdateProjectRequest struct {
 	Id *int `urlPath:"projectId" json:"-" validate:"required"`
 }
+
+type ProjectSettings struct {
+	ProjectId        *int               `json:"projectId"`
+	ExcludeGenerated *bool              `json:"excludeGenerated"`
+	ExcludeVendored  *bool              `json:"excludeVendored"`
+	ExcludeLockFiles *bool              `json:"excludeLockFiles"`
+	Generation       *GenerationOptions `json:"generation"`
+	MonthlyBudget    *float64           `json:"monthlyBudget"`
+
+	// SystemPrompt is edited through its own endpoint. The embedded instructions are used when it is nil.
+	SystemPrompt *string `json:"-"`
+}
+
+type GetProjectSettingsRequest struct {
+	Id *int `urlPath:"projectId" json:"-" validate:"required"`
+}
+
+type UpdateProjectSettingsRequest struct {
+	Id               *int               `urlPath:"projectId" json:"-" validate:"required"`
+	ExcludeGenerated *bool              `json:"excludeGenerated"`
+	ExcludeVendored  *bool              `json:"excludeVendored"`
+	ExcludeLockFiles *bool              `json:"excludeLockFiles"`
+	Generation       *GenerationOptions `json:"generation"`
+	MonthlyBudget    *float64           `json:"monthlyBudget"`
+}
@@ -0,0 +1,22 @@
+package models
+
+type GetProjectPromptRequest struct {
+	Id *int `urlPath:"projectId" json:"-" validate:"required"`
+}
+
+type UpdateProjectPromptRequest struct {
+	Id     *int    `urlPath:"projectId" json:"-" validate:"required"`
+	Prompt *string `json:"prompt"`
+}
+
+type ProjectPrompt struct {
+	ProjectId *int `json:"projectId"`
+
+	// Prompt is the template of the system prompt. It is the default instructions when Default is true.
+	Prompt  string `json:"prompt"`
+	Default bool   `json:"default"`
+
+	// Resolved is the prompt with its variables replaced, as sent to the model.
+	Resolved  string   `json:"resolved"`
+	Variables []string `json:"variables"`
+}
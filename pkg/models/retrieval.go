@@ -0,0 +1,12 @@
+package models
+
+type RetrievalChunk struct {
+	ProjectId int       `json:"projectId"`
+	Path      string    `json:"path"`
+	FileHash  string    `json:"fileHash"`
+	StartLine int       `json:"startLine"`
+	EndLine   int       `json:"endLine"`
+	Content   string    `json:"content"`
+	Embedder  string    `json:"embedder"`
+	Vector    []float32 `json:"-"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+type SearchRequest struct {
+	ProjectId *int    `urlPath:"projectId" json:"-" validate:"required"`
+	Query     *string `urlQuery:"q" json:"-" validate:"required"`
+	Limit     *int    `urlQuery:"limit" json:"-"`
+}
+
+type SearchResult struct {
+	Path      string  `json:"path"`
+	StartLine int     `json:"startLine"`
+	EndLine   int     `json:"endLine"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Results []*SearchResult `json:"results"`
+}
+
+type SearchChunk struct {
+	Path      string
+	StartLine int
+	EndLine   int
+	Content   string
+
+	// Terms are the words of the identifiers of the content, so that a search for a word finds the identifiers that
+	// contain it.
+	Terms string
+}
+
+type SearchFile struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+type PromptTemplate struct {
+	Id          *int       `json:"id"`
+	Name        *string    `json:"name"`
+	Description *string    `json:"description"`
+	Content     *string    `json:"content"`
+	Variables   []string   `json:"variables"`
+	BuiltIn     *bool      `json:"builtIn"`
+	CreatedTime *time.Time `json:"createdTime"`
+	UpdateTime  *time.Time `json:"updateTime"`
+}
+
+type GetPromptTemplateRequest struct {
+	Id *int `urlPath:"templateId" json:"-" validate:"required"`
+}
+
+type ListPromptTemplatesRequest struct {
+	Limit *int `urlQuery:"limit" json:"-"`
+}
+
+type ListPromptTemplatesResponse struct {
+	Templates []*PromptTemplate `json:"templates"`
+}
+
+type CreatePromptTemplateRequest struct {
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description"`
+	Content     string `json:"content" validate:"required"`
+}
+
+type UpdatePromptTemplateRequest struct {
+	Id          *int    `urlPath:"templateId" json:"-" validate:"required"`
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Content     *string `json:"content"`
+}
+
+type DeletePromptTemplateRequest struct {
+	Id *int `urlPath:"templateId" json:"-" validate:"required"`
+}
+
+// ChatTemplate references a prompt template by ID or by name, with the values of its variables. The server renders
+// it and appends it to the messages of the chat as a new user message.
+type ChatTemplate struct {
+	Id        *int              `json:"id,omitempty"`
+	Name      *string           `json:"name,omitempty"`
+	Variables map[string]string `json:"variables,omitempty"`
+}
@@ -0,0 +1,37 @@
+package models
+
+type UsageRecord struct {
+	ProjectId        *int    `json:"projectId"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CachedTokens     int     `json:"cachedTokens"`
+	Estimated        bool    `json:"estimated"`
+	Cost             float64 `json:"cost"`
+}
+
+type UsageRequest struct {
+	ProjectId *int    `urlQuery:"projectId" json:"-"`
+	From      *string `urlQuery:"from" json:"-"`
+	To        *string `urlQuery:"to" json:"-"`
+}
+
+type UsageAggregate struct {
+	Day              string  `json:"day"`
+	ProjectId        *int    `json:"projectId"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	CachedTokens     int     `json:"cachedTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+type UsageResponse struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Usage     []*UsageAggregate `json:"usage"`
+	TotalCost float64           `json:"totalCost"`
+}
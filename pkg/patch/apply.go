@@ -0,0 +1,230 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// newFileMode is the mode of the files created by a patch.
+	newFileMode = 0o644
+
+	// newDirectoryMode is the mode of the directories created for the files of a patch.
+	newDirectoryMode = 0o755
+)
+
+// Change is the new content of a file of the project, computed from a patch or from a backup. Before and After are
+// nil when the file does not exist on that side.
+type Change struct {
+	Path         string
+	AbsolutePath string
+	Operation    string
+	Before       []byte
+	After        []byte
+}
+
+// Prepare checks the patches against the files of the project at root and computes the changes to write. Besides the
+// checks of Validate, a patch that modifies or deletes a file needs the hash of the file it was validated against, a
+// patch conflicts when its file changed since it was validated, and a file can only be patched once. The changes are
+// only returned when every patch can be applied.
+func Prepare(root string, patches []*models.FilePatch) ([]*Change, []*models.PatchFileResult) {
+	changes := make([]*Change, 0, len(patches))
+	results := make([]*models.PatchFileResult, 0, len(patches))
+	seen := make(map[string]bool)
+	applicable := true
+
+	for _, filePatch := range patches {
+		result := &models.PatchFileResult{
+			Path:      filePatch.Path,
+			Operation: filePatch.Operation,
+		}
+		results = append(results, result)
+
+		change, conflict, err := prepareChange(root, filePatch, seen)
+		if err != nil {
+			result.Conflict = conflict
+			result.Errors = append(result.Errors, err.Error())
+			applicable = false
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	if !applicable {
+		return nil, results
+	}
+	return changes, results
+}
+
+func prepareChange(root string, filePatch *models.FilePatch, seen map[string]bool) (*Change, bool, error) {
+	absolutePath, err := Resolve(root, filePatch.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	if seen[absolutePath] {
+		return nil, false, fmt.Errorf("%s has more than one patch", filePatch.Path)
+	}
+	seen[absolutePath] = true
+
+	if filePatch.BaseHash == "" && (filePatch.Operation == models.PatchOperationModify || filePatch.Operation == models.PatchOperationDelete) {
+		return nil, false, fmt.Errorf("the patch of %s has no base hash, it must be validated against the file first", filePatch.Path)
+	}
+
+	content, exists, err := readTarget(root, filePatch.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	if filePatch.BaseHash != "" && (!exists || Hash(content) != filePatch.BaseHash) {
+		return nil, true, fmt.Errorf("%s changed since the patch was validated", filePatch.Path)
+	}
+	if filePatch.BaseHash == "" && exists && filePatch.Operation == models.PatchOperationCreate {
+		return nil, true, fmt.Errorf("%s was created since the patch was validated", filePatch.Path)
+	}
+
+	after, err := applyPatch(filePatch, content, exists)
+	if err != nil {
+		return nil, false, err
+	}
+	change := &Change{
+		Path:         path.Clean(filepath.ToSlash(filePatch.Path)),
+		AbsolutePath: absolutePath,
+		Operation:    filePatch.Operation,
+		After:        after,
+	}
+	if exists {
+		change.Before = content
+	}
+	return change, false, nil
+}
+
+// Revert checks that the files of an applied patch set are still as the patch set left them, and computes the changes
+// that restore their backups.
+func Revert(root string, patchSet *models.PatchSet) ([]*Change, []*models.PatchFileResult) {
+	changes := make([]*Change, 0, len(patchSet.Files))
+	results := make([]*models.PatchFileResult, 0, len(patchSet.Files))
+	applicable := true
+
+	for _, file := range patchSet.Files {
+		result := &models.PatchFileResult{
+			Path:      file.Path,
+			Operation: file.Operation,
+		}
+		results = append(results, result)
+
+		change, conflict, err := revertChange(root, file)
+		if err != nil {
+			result.Conflict = conflict
+			result.Errors = append(result.Errors, err.Error())
+			applicable = false
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	if !applicable {
+		return nil, results
+	}
+	return changes, results
+}
+
+func revertChange(root string, file *models.PatchSetFile) (*Change, bool, error) {
+	absolutePath, err := Resolve(root, file.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	content, exists, err := readTarget(root, file.Path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if file.Operation == models.PatchOperationDelete {
+		if exists {
+			return nil, true, fmt.Errorf("%s was created again since the patch was applied", file.Path)
+		}
+	} else if !exists || Hash(content) != file.AppliedHash {
+		return nil, true, fmt.Errorf("%s changed since the patch was applied", file.Path)
+	}
+
+	change := &Change{
+		Path:         file.Path,
+		AbsolutePath: absolutePath,
+		Operation:    file.Operation,
+		Before:       content,
+	}
+	if file.Operation != models.PatchOperationCreate {
+		change.After = file.Backup
+		if change.After == nil {
+			change.After = []byte{}
+		}
+	}
+	return change, false, nil
+}
+
+// Write writes the changes to the files. Every file is replaced atomically. If a file cannot be written, the files
+// that were already written are restored, so the changes are applied all together or not at all.
+func Write(changes []*Change) error {
+	for i, change := range changes {
+		if err := writeFile(change.AbsolutePath, change.After); err != nil {
+			err = fmt.Errorf("failed to write %s (%w)", change.Path, err)
+			for _, written := range changes[:i] {
+				if restoreErr := writeFile(written.AbsolutePath, written.Before); restoreErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to restore %s (%w)", written.Path, restoreErr))
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile replaces the content of a file through a temporary file in the same directory, which is renamed over it.
+// The file is removed when the content is nil.
+func writeFile(absolutePath string, content []byte) (returnErr error) {
+	if content == nil {
+		if err := os.Remove(absolutePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	mode := fs.FileMode(newFileMode)
+	if info, err := os.Stat(absolutePath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	directory := filepath.Dir(absolutePath)
+	if err := os.MkdirAll(directory, newDirectoryMode); err != nil {
+		return err
+	}
+
+	temporary, err := os.CreateTemp(directory, "."+filepath.Base(absolutePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if returnErr != nil {
+			_ = os.Remove(temporary.Name())
+		}
+	}()
+
+	if _, err := temporary.Write(content); err != nil {
+		_ = temporary.Close()
+		return err
+	}
+	if err := temporary.Sync(); err != nil {
+		_ = temporary.Close()
+		return err
+	}
+	if err := temporary.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temporary.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(temporary.Name(), absolutePath)
+}
@@ -0,0 +1,156 @@
+package patch
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// devNull is the path of the missing side of a diff that creates or deletes a file.
+	devNull = "/dev/null"
+)
+
+var (
+	// hunkHeaderPattern matches the header of a hunk, such as @@ -12,7 +12,8 @@ func main() {.
+	hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+)
+
+// Parse finds the unified diffs in the text of an answer, in code blocks or not, and returns a patch per file. The
+// line counts of the hunk headers are recomputed from their lines, since models often get them wrong. A diff that
+// cannot be parsed is returned as an invalid patch with the reason in its errors, so it does not hide the other files.
+func Parse(text string) []*models.FilePatch {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	patches := make([]*models.FilePatch, 0)
+
+	for i := 0; i < len(lines); i++ {
+		if !isFileHeader(lines, i) {
+			continue
+		}
+		oldPath := headerPath(lines[i], "--- ")
+		newPath := headerPath(lines[i+1], "+++ ")
+		filePatch, err := newFilePatch(oldPath, newPath)
+		if err != nil {
+			patches = append(patches, &models.FilePatch{
+				Path:   cmp.Or(newPath, oldPath),
+				Errors: []string{err.Error()},
+			})
+			i++
+			continue
+		}
+		i += 2
+
+		for i < len(lines) && hunkHeaderPattern.MatchString(lines[i]) {
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				filePatch.Errors = append(filePatch.Errors, fmt.Sprintf("invalid hunk in the diff of %s (%s)", filePatch.Path, err.Error()))
+				break
+			}
+			filePatch.Hunks = append(filePatch.Hunks, hunk)
+			i = next
+		}
+		if len(filePatch.Hunks) == 0 && len(filePatch.Errors) == 0 {
+			filePatch.Errors = append(filePatch.Errors, fmt.Sprintf("the diff of %s has no hunk", filePatch.Path))
+		}
+		patches = append(patches, filePatch)
+		i--
+	}
+
+	return patches
+}
+
+// isFileHeader returns whether the lines at i are the --- and +++ lines that start the diff of a file.
+func isFileHeader(lines []string, i int) bool {
+	return i+2 < len(lines) &&
+		strings.HasPrefix(lines[i], "--- ") &&
+		strings.HasPrefix(lines[i+1], "+++ ") &&
+		hunkHeaderPattern.MatchString(lines[i+2])
+}
+
+// headerPath returns the path of a --- or +++ line, without the a/ or b/ prefix of git and the timestamp of diff.
+func headerPath(line string, prefix string) string {
+	path := strings.TrimPrefix(line, prefix)
+	if tab := strings.IndexByte(path, '\t'); tab >= 0 {
+		path = path[:tab]
+	}
+	path = strings.TrimSpace(path)
+	if path == devNull {
+		return path
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+func newFilePatch(oldPath string, newPath string) (*models.FilePatch, error) {
+	switch {
+	case oldPath == devNull && newPath == devNull:
+		return nil, fmt.Errorf("a diff has no path")
+	case oldPath == devNull:
+		return &models.FilePatch{Path: newPath, Operation: models.PatchOperationCreate}, nil
+	case newPath == devNull:
+		return &models.FilePatch{Path: oldPath, Operation: models.PatchOperationDelete}, nil
+	case oldPath != newPath:
+		return nil, fmt.Errorf("the diff from %s to %s renames a file, which is not supported", oldPath, newPath)
+	default:
+		return &models.FilePatch{Path: newPath, Operation: models.PatchOperationModify}, nil
+	}
+}
+
+// parseHunk parses the hunk that starts at the header at i, and returns it with the index of the line after it. The
+// hunk ends at the first line that is not part of a diff. Empty lines are taken as empty context lines, except at
+// the end of the hunk.
+func parseHunk(lines []string, i int) (*models.PatchHunk, int, error) {
+	match := hunkHeaderPattern.FindStringSubmatch(lines[i])
+	hunk := &models.PatchHunk{
+		Lines: make([]string, 0),
+	}
+	var err error
+	if hunk.OldStart, err = strconv.Atoi(match[1]); err != nil {
+		return nil, 0, err
+	}
+	if hunk.NewStart, err = strconv.Atoi(match[3]); err != nil {
+		return nil, 0, err
+	}
+
+	end := i + 1
+	for ; end < len(lines) && !isFileHeader(lines, end); end++ {
+		line := lines[end]
+		if line == "" {
+			hunk.Lines = append(hunk.Lines, " ")
+			continue
+		}
+		if line[0] == '\\' {
+			continue
+		}
+		if line[0] != ' ' && line[0] != '-' && line[0] != '+' {
+			break
+		}
+		hunk.Lines = append(hunk.Lines, line)
+	}
+	for len(hunk.Lines) > 0 && hunk.Lines[len(hunk.Lines)-1] == " " && lines[end-1] == "" {
+		hunk.Lines = hunk.Lines[:len(hunk.Lines)-1]
+		end--
+	}
+
+	for _, line := range hunk.Lines {
+		switch line[0] {
+		case ' ':
+			hunk.OldLines++
+			hunk.NewLines++
+		case '-':
+			hunk.OldLines++
+		case '+':
+			hunk.NewLines++
+		}
+	}
+	if hunk.OldLines == 0 && hunk.NewLines == 0 {
+		return nil, 0, fmt.Errorf("the hunk at '%s' has no line", lines[i])
+	}
+	return hunk, end, nil
+}
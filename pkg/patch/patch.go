@@ -0,0 +1,260 @@
+package patch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+// Validate checks every patch against the current files of the project at root. A patch is valid when its path stays
+// in the root, the file exists unless the patch creates it, and the context and removed lines of every hunk match the
+// file. The hash of the file is recorded in the patch, so a later change of the file can be detected.
+func Validate(root string, patches []*models.FilePatch) {
+	for _, filePatch := range patches {
+		filePatch.BaseHash = ""
+		filePatch.Errors = nil
+		content, exists, err := readTarget(root, filePatch.Path)
+		if err == nil {
+			if exists {
+				filePatch.BaseHash = Hash(content)
+			}
+			_, err = applyPatch(filePatch, content, exists)
+		}
+		if err != nil {
+			filePatch.Errors = append(filePatch.Errors, err.Error())
+		}
+		filePatch.Valid = len(filePatch.Errors) == 0
+	}
+}
+
+// Hash returns the hash of the content of a file, as recorded in the patches.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Resolve returns the absolute path of a path relative to the root of a project. The path must be relative, must not
+// leave the root, must not go through a symbolic link that leads out of the root, and must not be in a .git directory.
+func Resolve(root string, relativePath string) (string, error) {
+	if relativePath == "" {
+		return "", fmt.Errorf("the path is empty")
+	}
+	slashPath := filepath.ToSlash(relativePath)
+	if path.IsAbs(slashPath) || filepath.IsAbs(relativePath) || filepath.VolumeName(relativePath) != "" {
+		return "", fmt.Errorf("the path %s is absolute", relativePath)
+	}
+	cleaned := path.Clean(slashPath)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("the path %s is outside of the project", relativePath)
+	}
+	if inGitDirectory(cleaned) {
+		return "", fmt.Errorf("the path %s is in a .git directory", relativePath)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the project root (%w)", err)
+	}
+	absolutePath := filepath.Join(realRoot, filepath.FromSlash(cleaned))
+
+	// The deepest existing parent is resolved, since the file itself and its directories may not exist yet.
+	existing := absolutePath
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to check the path %s (%w)", relativePath, err)
+		}
+		existing = filepath.Dir(existing)
+	}
+	realExisting, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the path %s (%w)", relativePath, err)
+	}
+	relative, err := filepath.Rel(realRoot, realExisting)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("the path %s is outside of the project", relativePath)
+	}
+	if inGitDirectory(filepath.ToSlash(relative)) {
+		return "", fmt.Errorf("the path %s is in a .git directory", relativePath)
+	}
+
+	return absolutePath, nil
+}
+
+// inGitDirectory reports whether a slash separated path has a .git element. The case is ignored, since the file
+// systems of macOS and Windows ignore it too.
+func inGitDirectory(slashPath string) bool {
+	for _, element := range strings.Split(slashPath, "/") {
+		if strings.EqualFold(element, ".git") {
+			return true
+		}
+	}
+	return false
+}
+
+// readTarget reads the file a patch applies to, and returns whether it exists.
+func readTarget(root string, relativePath string) ([]byte, bool, error) {
+	absolutePath, err := Resolve(root, relativePath)
+	if err != nil {
+		return nil, false, err
+	}
+	info, err := os.Stat(absolutePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check %s (%w)", relativePath, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, false, fmt.Errorf("%s is not a regular file", relativePath)
+	}
+	content, err := os.ReadFile(absolutePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s (%w)", relativePath, err)
+	}
+	return content, true, nil
+}
+
+// applyPatch applies a patch to the content of its file and returns the new content, which is nil when the patch
+// deletes the file.
+func applyPatch(filePatch *models.FilePatch, content []byte, exists bool) ([]byte, error) {
+	switch filePatch.Operation {
+	case models.PatchOperationCreate:
+		if exists {
+			return nil, fmt.Errorf("%s already exists", filePatch.Path)
+		}
+	case models.PatchOperationModify, models.PatchOperationDelete:
+		if !exists {
+			return nil, fmt.Errorf("%s does not exist", filePatch.Path)
+		}
+	default:
+		return nil, fmt.Errorf("unknown patch operation '%s' for %s", filePatch.Operation, filePatch.Path)
+	}
+
+	text := string(content)
+	newline := "\n"
+	if strings.Contains(text, "\r\n") {
+		newline = "\r\n"
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	finalNewline := text == "" || strings.HasSuffix(text, "\n")
+	lines := make([]string, 0)
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+
+	patched, err := applyHunks(filePatch, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	if filePatch.Operation == models.PatchOperationDelete {
+		if len(patched) > 0 {
+			return nil, fmt.Errorf("the diff deleting %s does not remove all of its lines", filePatch.Path)
+		}
+		return nil, nil
+	}
+	if len(patched) == 0 {
+		return []byte{}, nil
+	}
+	result := strings.Join(patched, newline)
+	if finalNewline {
+		result += newline
+	}
+	return []byte(result), nil
+}
+
+// applyHunks applies the hunks in order. A hunk is placed at the line of its header when its old lines match there,
+// otherwise at the closest place after the previous hunk where they match, since models often get the line numbers
+// wrong. Trailing whitespace is ignored when matching, and the context lines of the file are kept as they are.
+func applyHunks(filePatch *models.FilePatch, lines []string) ([]string, error) {
+	result := make([]string, 0, len(lines))
+	next := 0
+	for index, hunk := range filePatch.Hunks {
+		oldLines := make([]string, 0, len(hunk.Lines))
+		for _, line := range hunk.Lines {
+			if line == "" {
+				return nil, fmt.Errorf("hunk %d of %s has a line without a prefix", index+1, filePatch.Path)
+			}
+			switch line[0] {
+			case ' ', '-':
+				oldLines = append(oldLines, line[1:])
+			case '+':
+			default:
+				return nil, fmt.Errorf("hunk %d of %s has a line with the unknown prefix '%c'", index+1, filePatch.Path, line[0])
+			}
+		}
+
+		position := findHunk(lines, oldLines, hunk.OldStart-1, next)
+		if position < 0 {
+			return nil, fmt.Errorf("hunk %d of %s does not match the file near line %d", index+1, filePatch.Path, hunk.OldStart)
+		}
+
+		result = append(result, lines[next:position]...)
+		fileLine := position
+		for _, line := range hunk.Lines {
+			switch line[0] {
+			case ' ':
+				result = append(result, lines[fileLine])
+				fileLine++
+			case '-':
+				fileLine++
+			case '+':
+				result = append(result, line[1:])
+			}
+		}
+		next = fileLine
+	}
+	return append(result, lines[next:]...), nil
+}
+
+// findHunk returns the position of the old lines of a hunk in the file at or after the minimum, the closest to the
+// expected position, or -1 if they are not found.
+func findHunk(lines []string, oldLines []string, expected int, minimum int) int {
+	if len(oldLines) == 0 {
+		// A hunk without old lines has nothing to match, its lines are added after the line of its header.
+		position := max(expected+1, minimum)
+		if position > len(lines) {
+			return -1
+		}
+		return position
+	}
+
+	last := len(lines) - len(oldLines)
+	if last < minimum {
+		return -1
+	}
+	// The expected position is brought within the possible positions, so that a header with a line far past the end
+	// of the file does not search every line in between. The closest position stays the same.
+	expected = min(max(expected, minimum), last)
+	for distance := 0; ; distance++ {
+		before, after := expected-distance, expected+distance
+		if before < minimum && after > last {
+			return -1
+		}
+		if after >= minimum && after <= last && matches(lines[after:], oldLines) {
+			return after
+		}
+		if distance > 0 && before >= minimum && before <= last && matches(lines[before:], oldLines) {
+			return before
+		}
+	}
+}
+
+func matches(lines []string, oldLines []string) bool {
+	for i, oldLine := range oldLines {
+		if strings.TrimRight(lines[i], " \t") != strings.TrimRight(oldLine, " \t") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,189 @@
+package patch
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+func TestFindHunk(t *testing.T) {
+	lines := []string{"a", "b", "c", "b", "c"}
+
+	testCases := []struct {
+		name     string
+		oldLines []string
+		expected int
+		minimum  int
+		position int
+	}{
+		{name: "at the expected line", oldLines: []string{"b", "c"}, expected: 3, minimum: 0, position: 3},
+		{name: "closest to the expected line", oldLines: []string{"b", "c"}, expected: 2, minimum: 0, position: 3},
+		{name: "after the minimum", oldLines: []string{"b", "c"}, expected: 0, minimum: 2, position: 3},
+		{name: "past the end of the file", oldLines: []string{"b", "c"}, expected: 1000, minimum: 0, position: 3},
+		{name: "before the start of the file", oldLines: []string{"a"}, expected: -1000, minimum: 0, position: 0},
+		{name: "not found", oldLines: []string{"d"}, expected: 0, minimum: 0, position: -1},
+		{name: "longer than the rest of the file", oldLines: []string{"c", "b", "c"}, expected: 0, minimum: 3, position: -1},
+		{name: "no old lines", oldLines: nil, expected: 1, minimum: 0, position: 2},
+		{name: "no old lines past the end of the file", oldLines: nil, expected: 10, minimum: 0, position: -1},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			position := findHunk(lines, testCase.oldLines, testCase.expected, testCase.minimum)
+			if position != testCase.position {
+				t.Fatalf("expected the position %d, got %d", testCase.position, position)
+			}
+		})
+	}
+}
+
+func TestValidateWithAHugeStartLine(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n\nfunc main() {\n}\n"), 0o644); err != nil {
+		t.Fatalf("failed to write the file (%s)", err)
+	}
+	start := strconv.Itoa(math.MaxInt)
+	patches := Parse(strings.Join([]string{
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -" + start + ",2 +" + start + ",3 @@",
+		" func main() {",
+		"+\tprintln(\"hello\")",
+		" }",
+	}, "\n"))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Validate(root, patches)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the validation did not finish")
+	}
+	if len(patches) != 1 || !patches[0].Valid {
+		t.Fatalf("expected a valid patch, got %+v", patches)
+	}
+}
+
+func TestParseKeepsTheDiffsThatCanBeParsed(t *testing.T) {
+	patches := Parse(strings.Join([]string{
+		"--- a/old.go",
+		"+++ b/new.go",
+		"@@ -1 +1 @@",
+		"-package old",
+		"+package new",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -1 +1 @@",
+		"-package main",
+		"+package app",
+	}, "\n"))
+
+	if len(patches) != 2 {
+		t.Fatalf("expected 2 patches, got %d", len(patches))
+	}
+	if patches[0].Path != "new.go" || len(patches[0].Errors) != 1 || !strings.Contains(patches[0].Errors[0], "renames a file") {
+		t.Fatalf("expected the rename to be reported, got %+v", patches[0])
+	}
+	expected := &models.PatchHunk{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-package main", "+package app"}}
+	if patches[1].Path != "main.go" || patches[1].Operation != models.PatchOperationModify || len(patches[1].Errors) != 0 || len(patches[1].Hunks) != 1 {
+		t.Fatalf("unexpected patch %+v", patches[1])
+	}
+	hunk := patches[1].Hunks[0]
+	if hunk.OldStart != expected.OldStart || hunk.OldLines != expected.OldLines || hunk.NewLines != expected.NewLines || strings.Join(hunk.Lines, "\n") != strings.Join(expected.Lines, "\n") {
+		t.Fatalf("expected the hunk %+v, got %+v", expected, hunk)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "pkg"), 0o755); err != nil {
+		t.Fatalf("failed to create the directory (%s)", err)
+	}
+	if err := os.Symlink(filepath.Join(root, ".git"), filepath.Join(root, "hooks")); err != nil {
+		t.Fatalf("failed to create the link (%s)", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatalf("failed to create the directory (%s)", err)
+	}
+
+	testCases := []struct {
+		path      string
+		errorText string
+	}{
+		{path: "pkg/main.go"},
+		{path: "pkg/new/main.go"},
+		{path: "", errorText: "is empty"},
+		{path: "/etc/passwd", errorText: "is absolute"},
+		{path: "../main.go", errorText: "outside of the project"},
+		{path: "pkg/../../main.go", errorText: "outside of the project"},
+		{path: ".git/config", errorText: "in a .git directory"},
+		{path: "pkg/.GIT/hooks/pre-commit", errorText: "in a .git directory"},
+		{path: "hooks/pre-commit", errorText: "in a .git directory"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.path, func(t *testing.T) {
+			_, err := Resolve(root, testCase.path)
+			if testCase.errorText == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if testCase.errorText != "" && (err == nil || !strings.Contains(err.Error(), testCase.errorText)) {
+				t.Fatalf("expected an error containing %q, got %v", testCase.errorText, err)
+			}
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	content := []byte("package main\n")
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), content, 0o644); err != nil {
+		t.Fatalf("failed to write the file (%s)", err)
+	}
+	modify := func(baseHash string) *models.FilePatch {
+		return &models.FilePatch{
+			Path:      "main.go",
+			Operation: models.PatchOperationModify,
+			BaseHash:  baseHash,
+			Hunks:     []*models.PatchHunk{{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 1, Lines: []string{"-package main", "+package app"}}},
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		patch     *models.FilePatch
+		conflict  bool
+		errorText string
+	}{
+		{name: "validated patch", patch: modify(Hash(content))},
+		{name: "without a base hash", patch: modify(""), errorText: "has no base hash"},
+		{name: "changed file", patch: modify(Hash([]byte("package old\n"))), conflict: true, errorText: "changed since the patch was validated"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			changes, results := Prepare(root, []*models.FilePatch{testCase.patch})
+			if len(results) != 1 || results[0].Conflict != testCase.conflict {
+				t.Fatalf("unexpected results %+v", results)
+			}
+			if testCase.errorText == "" {
+				if changes == nil || len(results[0].Errors) != 0 || string(changes[0].After) != "package app\n" {
+					t.Fatalf("expected the patch to apply, got %+v", results[0])
+				}
+				return
+			}
+			if changes != nil || len(results[0].Errors) != 1 || !strings.Contains(results[0].Errors[0], testCase.errorText) {
+				t.Fatalf("expected an error containing %q, got %+v", testCase.errorText, results[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package retrieval
+
+import (
+	"strings"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+)
+
+const (
+	// maxChunkSize keeps a chunk of long lines, such as minified code, well below the input limit of the embedders.
+	maxChunkSize = 6000
+)
+
+// chunkFile splits a file into chunks of at most chunkLines lines. Blank chunks are dropped.
+func chunkFile(file *amalgam.File, chunkLines int, embedder string) []*models.RetrievalChunk {
+	lines := strings.Split(strings.TrimSuffix(file.Content, "\n"), "\n")
+	chunks := make([]*models.RetrievalChunk, 0, len(lines)/chunkLines+1)
+
+	for start := 0; start < len(lines); {
+		end := start
+		size := 0
+		for end < len(lines) && end-start < chunkLines && (end == start || size+len(lines[end]) <= maxChunkSize) {
+			size += len(lines[end]) + 1
+			end++
+		}
+
+		content := strings.Join(lines[start:end], "\n")
+		if len(content) > maxChunkSize {
+			content = content[:maxChunkSize]
+		}
+		if strings.TrimSpace(content) != "" {
+			chunks = append(chunks, &models.RetrievalChunk{
+				Path:      file.Path,
+				FileHash:  file.Hash,
+				StartLine: start + 1,
+				EndLine:   end,
+				Content:   content,
+				Embedder:  embedder,
+			})
+		}
+		start = end
+	}
+
+	return chunks
+}
+
+// embeddingText is the text embedded for a chunk. The path helps to match questions that name a file or a package.
+func embeddingText(chunk *models.RetrievalChunk) string {
+	return "// File: " + chunk.Path + "\n\n" + chunk.Content
+}
@@ -0,0 +1,350 @@
+package retrieval
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/ai"
+	"github.com/TriangleSide/CodebaseAI/pkg/ai/openai"
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/config"
+	"github.com/TriangleSide/CodebaseAI/pkg/db/daos/chunks"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/CodebaseAI/pkg/watcher"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	EmbedderOpenAI = "openai"
+	EmbedderHash   = "hash"
+
+	// hashDimensions is the length of the vectors of the hash embedder.
+	hashDimensions = 1024
+
+	// embedBatchSize is the amount of chunks embedded per call of the embedder.
+	embedBatchSize = 64
+)
+
+// Index keeps the chunks of the files of the projects and their vectors, and finds the chunks that are the most
+// similar to a question. A project is indexed on its first retrieval chat, then in the background whenever the watcher
+// reports that its files changed.
+type Index struct {
+	embedder   ai.Embedder
+	chunksDAO  chunks.DAO
+	watcher    watcher.Manager
+	chunkLines int
+	topK       int
+
+	// mutex guards the projects and their fields, except for their updating lock.
+	mutex    sync.Mutex
+	projects map[int]*indexedProject
+}
+
+// indexedProject is the state of a project that had a retrieval chat.
+type indexedProject struct {
+	id   int
+	root string
+
+	// options are the amalgam options of the chats of the project, by their JSON. The index holds the files of all of
+	// them, so that chats with different options do not remove each other's files.
+	options map[string]*models.AmalgamOptions
+
+	// indexed holds the keys of the options that were part of a successful update.
+	indexed map[string]bool
+
+	// refreshing is set while a background update runs, and pending when files changed during it.
+	refreshing bool
+	pending    bool
+
+	unsubscribe func()
+
+	// updating serializes the updates of the project, so that a chat and a background update do not embed the same
+	// files twice.
+	updating sync.Mutex
+}
+
+// New creates the index with the configured embedder.
+func New(cfg *config.Config, chunksDAO chunks.DAO, watcherManager watcher.Manager) (*Index, error) {
+	embedder, err := newEmbedder(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithEmbedder(embedder, chunksDAO, watcherManager, cfg.RetrievalChunkLines, cfg.RetrievalTopK), nil
+}
+
+// NewWithEmbedder creates the index with the given embedder.
+func NewWithEmbedder(embedder ai.Embedder, chunksDAO chunks.DAO, watcherManager watcher.Manager, chunkLines int, topK int) *Index {
+	return &Index{
+		embedder:   embedder,
+		chunksDAO:  chunksDAO,
+		watcher:    watcherManager,
+		chunkLines: max(chunkLines, 1),
+		topK:       max(topK, 1),
+		projects:   make(map[int]*indexedProject),
+	}
+}
+
+func newEmbedder(cfg *config.Config) (ai.Embedder, error) {
+	switch cfg.Embedder {
+	case EmbedderHash:
+		return ai.NewHashEmbedder(hashDimensions), nil
+	case EmbedderOpenAI:
+		if cfg.Provider != config.ProviderOpenAI && cfg.OpenaiApiKey == "" {
+			logger.Warnf("The OpenAI API has no key, the retrieval index uses the %s embedder.", EmbedderHash)
+			return ai.NewHashEmbedder(hashDimensions), nil
+		}
+		return openai.NewOpenAIEmbedder(cfg)
+	default:
+		return nil, fmt.Errorf("unknown embedder '%s'", cfg.Embedder)
+	}
+}
+
+// Prepare makes sure that the index of a project holds the files of the amalgam with the options. The project is
+// indexed in the request until the options were indexed once, and in the background after that, when its files
+// change.
+func (i *Index) Prepare(ctx context.Context, projectId int, root string, options *models.AmalgamOptions) error {
+	project, key := i.register(projectId, root, options)
+	if i.ready(project, key) {
+		return nil
+	}
+	project.updating.Lock()
+	defer project.updating.Unlock()
+	if i.ready(project, key) {
+		return nil
+	}
+	return i.update(ctx, project)
+}
+
+// register adds the options to the options of the project and returns their key. The first registration of a project
+// subscribes to its change events.
+func (i *Index) register(projectId int, root string, options *models.AmalgamOptions) (*indexedProject, string) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	project, ok := i.projects[projectId]
+	if !ok {
+		project = &indexedProject{
+			id:      projectId,
+			options: make(map[string]*models.AmalgamOptions),
+			indexed: make(map[string]bool),
+		}
+		i.projects[projectId] = project
+		events, unsubscribe := i.watcher.Subscribe(projectId)
+		project.unsubscribe = unsubscribe
+		go func() {
+			for range events {
+				i.refresh(project)
+			}
+		}()
+	}
+	if project.root != root {
+		// The path of the project changed, the options indexed for the old root have to be indexed again.
+		project.root = root
+		clear(project.options)
+		clear(project.indexed)
+	}
+
+	key := optionsKey(options)
+	project.options[key] = options
+	return project, key
+}
+
+// ready reports whether the options were part of a successful update of the project.
+func (i *Index) ready(project *indexedProject, key string) bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return project.indexed[key]
+}
+
+// refresh updates a project in the background. Changes that arrive during an update start another one once it is
+// done instead of running concurrently.
+func (i *Index) refresh(project *indexedProject) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if project.refreshing {
+		project.pending = true
+		return
+	}
+	project.refreshing = true
+
+	go func() {
+		for {
+			project.updating.Lock()
+			if err := i.update(context.Background(), project); err != nil {
+				logger.Errorf("Failed to update the retrieval index of project %d (%s).", project.id, err.Error())
+			}
+			project.updating.Unlock()
+
+			i.mutex.Lock()
+			if !project.pending {
+				project.refreshing = false
+				i.mutex.Unlock()
+				return
+			}
+			project.pending = false
+			i.mutex.Unlock()
+		}
+	}()
+}
+
+// Close stops the background updates.
+func (i *Index) Close() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	for _, project := range i.projects {
+		project.unsubscribe()
+	}
+	clear(i.projects)
+}
+
+// update brings the index of a project up to date with the files of the amalgams of its options. Only the files
+// whose content changed since the last update are embedded again, and the files that are in none of the amalgams are
+// removed. The caller must hold the updating lock of the project.
+func (i *Index) update(ctx context.Context, project *indexedProject) error {
+	i.mutex.Lock()
+	root := project.root
+	optionSets := maps.Clone(project.options)
+	i.mutex.Unlock()
+
+	files := make(map[string]*amalgam.File)
+	for _, options := range optionSets {
+		optionFiles, err := amalgam.Files(ctx, root, options)
+		if err != nil {
+			return fmt.Errorf("error reading the project files (%w)", err)
+		}
+		for _, file := range optionFiles {
+			files[file.Path] = file
+		}
+	}
+	indexed, err := i.chunksDAO.FileHashes(ctx, project.id, i.embedder.Name())
+	if err != nil {
+		return fmt.Errorf("error reading the index of the project (%w)", err)
+	}
+
+	changed := make([]*amalgam.File, 0)
+	for _, file := range files {
+		if hash, ok := indexed[file.Path]; !ok || hash != file.Hash {
+			changed = append(changed, file)
+		}
+		delete(indexed, file.Path)
+	}
+	for removed := range indexed {
+		if err := i.chunksDAO.ReplaceFile(ctx, project.id, removed, nil); err != nil {
+			return fmt.Errorf("error removing %s from the index (%w)", removed, err)
+		}
+	}
+	if len(changed) == 0 {
+		i.markIndexed(project, root, optionSets)
+		return nil
+	}
+	logger.Infof("Indexing %d changed files of project %d with the %s embedder.", len(changed), project.id, i.embedder.Name())
+
+	fileChunks := make(map[string][]*models.RetrievalChunk, len(changed))
+	pending := make([]*models.RetrievalChunk, 0)
+	for _, file := range changed {
+		fileChunks[file.Path] = chunkFile(file, i.chunkLines, i.embedder.Name())
+		pending = append(pending, fileChunks[file.Path]...)
+	}
+	for batch := range slices.Chunk(pending, embedBatchSize) {
+		texts := make([]string, 0, len(batch))
+		for _, chunk := range batch {
+			texts = append(texts, embeddingText(chunk))
+		}
+		vectors, err := i.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for j, chunk := range batch {
+			chunk.Vector = vectors[j]
+		}
+	}
+
+	for _, file := range changed {
+		if err := i.chunksDAO.ReplaceFile(ctx, project.id, file.Path, fileChunks[file.Path]); err != nil {
+			return fmt.Errorf("error indexing %s (%w)", file.Path, err)
+		}
+	}
+	i.markIndexed(project, root, optionSets)
+	return nil
+}
+
+// markIndexed records that the options were indexed, unless the path of the project changed during the update.
+func (i *Index) markIndexed(project *indexedProject, root string, optionSets map[string]*models.AmalgamOptions) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if project.root != root {
+		return
+	}
+	for key := range optionSets {
+		project.indexed[key] = true
+	}
+}
+
+// optionsKey identifies a set of amalgam options.
+func optionsKey(options *models.AmalgamOptions) string {
+	key, err := json.Marshal(options)
+	if err != nil {
+		return ""
+	}
+	return string(key)
+}
+
+// Search returns the chunks of the files of the amalgam with the options that are the most similar to the query, the
+// most similar first.
+func (i *Index) Search(ctx context.Context, projectId int, root string, options *models.AmalgamOptions, query string) ([]*models.RetrievalChunk, error) {
+	files, err := amalgam.List(ctx, root, options)
+	if err != nil {
+		return nil, fmt.Errorf("error listing the project files (%w)", err)
+	}
+	paths := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		paths[file.Path] = struct{}{}
+	}
+
+	vectors, err := i.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := i.chunksDAO.List(ctx, projectId, i.embedder.Name())
+	if err != nil {
+		return nil, fmt.Errorf("error reading the index of the project (%w)", err)
+	}
+	candidates := slices.DeleteFunc(indexed, func(chunk *models.RetrievalChunk) bool {
+		_, ok := paths[chunk.Path]
+		return !ok
+	})
+
+	type scoredChunk struct {
+		chunk *models.RetrievalChunk
+		score float64
+	}
+	scored := make([]scoredChunk, 0, len(candidates))
+	for _, candidate := range candidates {
+		scored = append(scored, scoredChunk{chunk: candidate, score: ai.CosineSimilarity(vectors[0], candidate.Vector)})
+	}
+	slices.SortStableFunc(scored, func(a, b scoredChunk) int {
+		return cmp.Compare(b.score, a.score)
+	})
+
+	retrieved := make([]*models.RetrievalChunk, 0, i.topK)
+	for _, candidate := range scored[:min(i.topK, len(scored))] {
+		retrieved = append(retrieved, candidate.chunk)
+	}
+	return retrieved, nil
+}
+
+// Render formats retrieved chunks as the codebase of a chat.
+func Render(retrieved []*models.RetrievalChunk) string {
+	sb := strings.Builder{}
+	sb.WriteString("Only the parts of the codebase that are the most relevant to the latest question are included.\n\n")
+	for _, chunk := range retrieved {
+		sb.WriteString(fmt.Sprintf("// File: %s (lines %d-%d)\n\n%s\n\n", chunk.Path, chunk.StartLine, chunk.EndLine, strings.Trim(chunk.Content, "\n")))
+	}
+	return sb.String()
+}
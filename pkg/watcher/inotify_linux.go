@@ -0,0 +1,166 @@
+//go:build linux
+
+package watcher
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+	// inotifyEventHeaderSize is the size of the fixed part of an inotify event, which is followed by the name.
+	inotifyEventHeaderSize = syscall.SizeofInotifyEvent
+
+	inotifyBufferSize = 64 * 1024
+)
+
+// inotifyNotifier watches every directory of a root that is not disallowed or ignored with inotify.
+type inotifyNotifier struct {
+	fd      int
+	file    *os.File
+	root    string
+	changes chan<- string
+	done    <-chan struct{}
+
+	mutex   sync.Mutex
+	watches map[int32]string
+}
+
+func startNotifier(root string, changes chan<- string, done <-chan struct{}) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize inotify (%w)", err)
+	}
+
+	n := &inotifyNotifier{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		root:    root,
+		changes: changes,
+		done:    done,
+		watches: make(map[int32]string),
+	}
+	if err := n.addWatches(); err != nil {
+		return nil, errors.Join(err, n.Close())
+	}
+
+	go n.run()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Close() error {
+	if err := n.file.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// addWatches watches every directory of the root that is not disallowed or ignored. Directories that are already
+// watched keep their watch descriptor.
+func (n *inotifyNotifier) addWatches() error {
+	directories, err := amalgam.Directories(context.Background(), n.root)
+	if err != nil {
+		return fmt.Errorf("failed to list the directories of %s (%w)", n.root, err)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, directory := range directories {
+		wd, err := syscall.InotifyAddWatch(n.fd, filepath.Join(n.root, filepath.FromSlash(directory)), inotifyMask)
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				continue
+			}
+			return fmt.Errorf("failed to watch directory %s (%w)", directory, err)
+		}
+		n.watches[int32(wd)] = directory
+	}
+	return nil
+}
+
+func (n *inotifyNotifier) run() {
+	buffer := make([]byte, inotifyBufferSize)
+	for {
+		count, err := n.file.Read(buffer)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logger.Errorf("Failed to read inotify events for %s (%s).", n.root, err.Error())
+			}
+			return
+		}
+		if !n.handleEvents(buffer[:count]) {
+			return
+		}
+	}
+}
+
+// handleEvents parses a batch of inotify events and forwards the changed paths. It returns false once the project
+// stopped being watched.
+func (n *inotifyNotifier) handleEvents(events []byte) bool {
+	rescan := false
+	for offset := 0; offset+inotifyEventHeaderSize <= len(events); {
+		wd := int32(binary.NativeEndian.Uint32(events[offset:]))
+		mask := binary.NativeEndian.Uint32(events[offset+4:])
+		nameLength := int(binary.NativeEndian.Uint32(events[offset+12:]))
+		nameBytes := events[offset+inotifyEventHeaderSize : offset+inotifyEventHeaderSize+nameLength]
+		offset += inotifyEventHeaderSize + nameLength
+
+		if mask&syscall.IN_Q_OVERFLOW != 0 {
+			rescan = true
+			if !sendChange(n.changes, n.done, ".") {
+				return false
+			}
+			continue
+		}
+
+		n.mutex.Lock()
+		directory, ok := n.watches[wd]
+		if mask&syscall.IN_IGNORED != 0 {
+			delete(n.watches, wd)
+		}
+		n.mutex.Unlock()
+		if !ok {
+			continue
+		}
+
+		changedPath := directory
+		if name := trimNul(nameBytes); name != "" {
+			changedPath = path.Join(directory, name)
+		}
+		if mask&syscall.IN_ISDIR != 0 && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			rescan = true
+		}
+		if !sendChange(n.changes, n.done, changedPath) {
+			return false
+		}
+	}
+
+	if rescan {
+		if err := n.addWatches(); err != nil {
+			logger.Errorf("Failed to watch the new directories of %s (%s).", n.root, err.Error())
+		}
+	}
+	return true
+}
+
+func trimNul(name []byte) string {
+	for i, b := range name {
+		if b == 0 {
+			return string(name[:i])
+		}
+	}
+	return string(name)
+}
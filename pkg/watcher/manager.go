@@ -0,0 +1,220 @@
+package watcher
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/CodebaseAI/pkg/models"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	// EventTypeChanged is published when files that are part of the amalgam of a project change.
+	EventTypeChanged = "changed"
+
+	// debounceInterval is how long the manager waits for more changes before publishing an event, so that bursts
+	// such as a branch checkout result in a single event.
+	debounceInterval = 250 * time.Millisecond
+
+	// maxEventPaths is the maximum amount of paths listed in a single event.
+	maxEventPaths = 100
+
+	changesBufferSize    = 1024
+	subscriberBufferSize = 16
+)
+
+// notifier reports the paths that change under a root, relative to the root and slash separated.
+type notifier interface {
+	Close() error
+}
+
+// Manager watches the directories of the registered projects, invalidates their cached amalgams when files change,
+// and publishes change events to subscribers.
+type Manager interface {
+	Watch(projectId int, root string) error
+	Unwatch(projectId int)
+	Subscribe(projectId int) (events <-chan *models.ProjectEvent, unsubscribe func())
+	Close()
+}
+
+type watchedProject struct {
+	id       int
+	root     string
+	notifier notifier
+	changes  chan string
+	done     chan struct{}
+}
+
+type manager struct {
+	mutex       sync.Mutex
+	projects    map[int]*watchedProject
+	subscribers map[int]map[chan *models.ProjectEvent]struct{}
+	nextEventId int
+}
+
+func NewManager() Manager {
+	return &manager{
+		projects:    make(map[int]*watchedProject),
+		subscribers: make(map[int]map[chan *models.ProjectEvent]struct{}),
+	}
+}
+
+// Watch starts watching the root of a project. Watching a project that is already watched restarts its watcher.
+func (m *manager) Watch(projectId int, root string) error {
+	m.Unwatch(projectId)
+
+	project := &watchedProject{
+		id:      projectId,
+		root:    root,
+		changes: make(chan string, changesBufferSize),
+		done:    make(chan struct{}),
+	}
+	n, err := startNotifier(root, project.changes, project.done)
+	if err != nil {
+		return fmt.Errorf("failed to watch project %d at %s (%w)", projectId, root, err)
+	}
+	project.notifier = n
+
+	m.mutex.Lock()
+	m.projects[projectId] = project
+	m.mutex.Unlock()
+
+	amalgam.EnableCache(root)
+	go m.debounce(project)
+
+	logger.Debugf("Watching project %d at %s.", projectId, root)
+	return nil
+}
+
+// Unwatch stops watching a project. It does nothing if the project is not watched.
+func (m *manager) Unwatch(projectId int) {
+	m.mutex.Lock()
+	project, ok := m.projects[projectId]
+	delete(m.projects, projectId)
+	m.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	close(project.done)
+	if err := project.notifier.Close(); err != nil {
+		logger.Errorf("Failed to close the watcher of project %d (%s).", projectId, err.Error())
+	}
+	amalgam.DisableCache(project.root)
+}
+
+// Subscribe returns the change events of a project. Events are dropped for subscribers that do not keep up. The
+// unsubscribe function must be called once the caller stops reading.
+func (m *manager) Subscribe(projectId int) (<-chan *models.ProjectEvent, func()) {
+	events := make(chan *models.ProjectEvent, subscriberBufferSize)
+
+	m.mutex.Lock()
+	if _, ok := m.subscribers[projectId]; !ok {
+		m.subscribers[projectId] = make(map[chan *models.ProjectEvent]struct{})
+	}
+	m.subscribers[projectId][events] = struct{}{}
+	m.mutex.Unlock()
+
+	unsubscribe := sync.OnceFunc(func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		delete(m.subscribers[projectId], events)
+		if len(m.subscribers[projectId]) == 0 {
+			delete(m.subscribers, projectId)
+		}
+		close(events)
+	})
+	return events, unsubscribe
+}
+
+// Close stops watching every project.
+func (m *manager) Close() {
+	m.mutex.Lock()
+	projectIds := make([]int, 0, len(m.projects))
+	for projectId := range m.projects {
+		projectIds = append(projectIds, projectId)
+	}
+	m.mutex.Unlock()
+
+	for _, projectId := range projectIds {
+		m.Unwatch(projectId)
+	}
+}
+
+// debounce collects the changes of a project until none arrive for the debounce interval, then invalidates the
+// cached amalgams and publishes a single event for the paths that are relevant to the default amalgam.
+func (m *manager) debounce(project *watchedProject) {
+	pending := make(map[string]struct{})
+	timer := time.NewTimer(debounceInterval)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-project.done:
+			return
+		case changedPath := <-project.changes:
+			pending[changedPath] = struct{}{}
+			timer.Reset(debounceInterval)
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			// The amalgams of requests with other options than the defaults can hold files that are not relevant to
+			// the default amalgam, so every change invalidates the cache.
+			amalgam.Invalidate(project.root)
+
+			paths := make([]string, 0, len(pending))
+			for changedPath := range pending {
+				if amalgam.Relevant(project.root, changedPath) {
+					paths = append(paths, changedPath)
+				}
+			}
+			pending = make(map[string]struct{})
+			if len(paths) > 0 {
+				m.publish(project.id, paths)
+			}
+		}
+	}
+}
+
+func (m *manager) publish(projectId int, paths []string) {
+	slices.Sort(paths)
+	truncated := len(paths) > maxEventPaths
+	if truncated {
+		paths = paths[:maxEventPaths]
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextEventId++
+	event := &models.ProjectEvent{
+		Id:        m.nextEventId,
+		ProjectId: projectId,
+		Type:      EventTypeChanged,
+		Paths:     paths,
+		Truncated: truncated,
+		Time:      time.Now(),
+	}
+	for subscriber := range m.subscribers[projectId] {
+		select {
+		case subscriber <- event:
+		default:
+			logger.Warnf("Dropped a change event of project %d for a slow subscriber.", projectId)
+		}
+	}
+}
+
+// sendChange forwards a changed path to the debouncer unless the project stopped being watched.
+func sendChange(changes chan<- string, done <-chan struct{}, changedPath string) bool {
+	select {
+	case <-done:
+		return false
+	case changes <- changedPath:
+		return true
+	}
+}
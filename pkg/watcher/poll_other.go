@@ -0,0 +1,115 @@
+//go:build !linux
+
+package watcher
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/TriangleSide/CodebaseAI/pkg/amalgam"
+	"github.com/TriangleSide/GoTools/pkg/logger"
+)
+
+const (
+	// pollInterval is how often the directories of a root are scanned on platforms without inotify.
+	pollInterval = 2 * time.Second
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// pollNotifier periodically scans every directory of a root that is not disallowed or ignored and reports the files
+// whose modification time or size changed.
+type pollNotifier struct {
+	root    string
+	changes chan<- string
+	done    <-chan struct{}
+	stop    chan struct{}
+}
+
+func startNotifier(root string, changes chan<- string, done <-chan struct{}) (notifier, error) {
+	n := &pollNotifier{
+		root:    root,
+		changes: changes,
+		done:    done,
+		stop:    make(chan struct{}),
+	}
+	snapshot, err := n.scan()
+	if err != nil {
+		return nil, err
+	}
+	go n.run(snapshot)
+	return n, nil
+}
+
+func (n *pollNotifier) Close() error {
+	close(n.stop)
+	return nil
+}
+
+func (n *pollNotifier) run(previous map[string]fileState) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			current, err := n.scan()
+			if err != nil {
+				logger.Errorf("Failed to scan %s for changes (%s).", n.root, err.Error())
+				continue
+			}
+			for changedPath, state := range current {
+				if previousState, ok := previous[changedPath]; !ok || previousState != state {
+					if !sendChange(n.changes, n.done, changedPath) {
+						return
+					}
+				}
+			}
+			for removedPath := range previous {
+				if _, ok := current[removedPath]; !ok {
+					if !sendChange(n.changes, n.done, removedPath) {
+						return
+					}
+				}
+			}
+			previous = current
+		}
+	}
+}
+
+func (n *pollNotifier) scan() (map[string]fileState, error) {
+	directories, err := amalgam.Directories(context.Background(), n.root)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string]fileState)
+	for _, directory := range directories {
+		entries, err := os.ReadDir(filepath.Join(n.root, filepath.FromSlash(directory)))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			snapshot[path.Join(directory, entry.Name())] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+			}
+		}
+	}
+	return snapshot, nil
+}
@@ -1,14 +1,48 @@
 import {Paths} from "@/api/Paths";
 import {Headers} from "@/api/Headers";
 
+export interface AmalgamFile {
+    path: string;
+    language?: string;
+    encoding?: string;
+    converted?: boolean;
+    hash: string;
+}
+
+export interface AmalgamExclusions {
+    generated: number;
+    vendoredDirectories: number;
+    lockFiles: number;
+}
+
 export interface AmalgamResponse {
+    hash: string;
     content: string;
     tokenCount: number;
+    files: AmalgamFile[];
+    excluded: AmalgamExclusions;
+}
+
+export interface AmalgamOptions {
+    include?: string[];
+    exclude?: string[];
+    includeTests?: boolean;
 }
 
 export default class AmalgamAPIClient {
-    static async fetchAmalgam(projectId: number): Promise<AmalgamResponse> {
-        const response = await fetch(Paths.amalgam(projectId) ,{
+    static async fetchAmalgam(projectId: number, options?: AmalgamOptions): Promise<AmalgamResponse> {
+        const queryParams = new URLSearchParams();
+        if (options?.include && options.include.length > 0) {
+            queryParams.set('include', options.include.join(','));
+        }
+        if (options?.exclude && options.exclude.length > 0) {
+            queryParams.set('exclude', options.exclude.join(','));
+        }
+        if (options?.includeTests !== undefined) {
+            queryParams.set('includeTests', options.includeTests.toString());
+        }
+
+        const response = await fetch(`${Paths.amalgam(projectId)}?${queryParams.toString()}` ,{
             headers: {
                 [Headers.ACCEPT]: Headers.APPLICATION_JSON,
             },
@@ -1,6 +1,7 @@
 import {Paths} from "@/api/Paths";
 import {Headers} from "@/api/Headers";
 import {Methods} from "@/api/Methods";
+import {AmalgamOptions} from "@/api/AmalgamAPIClient";
 
 export type role = string;
 
@@ -16,19 +17,106 @@ export interface Message {
     content: string;
 }
 
+export interface GenerationOptions {
+    temperature?: number;
+    topP?: number;
+    maxOutputTokens?: number;
+    stop?: string[];
+    seed?: number;
+    reasoningEffort?: 'low' | 'medium' | 'high';
+}
+
+export class ChatModes {
+    public static readonly AGENT: string = 'agent';
+    public static readonly RETRIEVAL: string = 'retrieval';
+    public static readonly PATCH: string = 'patch';
+}
+
 export interface ChatRequest {
     messages: Message[];
+    provider?: string;
+    model?: string;
+    projectId?: number;
+    amalgam?: AmalgamOptions;
+    generation?: GenerationOptions;
+    mode?: string;
+    template?: ChatTemplate;
+}
+
+export interface ChatTemplate {
+    id?: number;
+    name?: string;
+    variables?: Record<string, string>;
+}
+
+export interface ChatTrimmed {
+    messages: number;
+    tokens: number;
+}
+
+export interface ChatUsage {
+    promptTokens: number;
+    completionTokens: number;
+    cachedTokens: number;
+    estimated?: boolean;
+}
+
+export interface ChatStatus {
+    type: string;
+    attempt?: number;
+    maxAttempts?: number;
+    delayMs?: number;
+    message?: string;
+}
+
+export interface ChatToolCall {
+    id: string;
+    name: string;
+    arguments: string;
+}
+
+export interface ChatToolResult {
+    id: string;
+    name: string;
+    output: string;
+    truncated?: boolean;
+    error?: string;
 }
 
 export interface ChatResponse {
     content: string | null;
     done: boolean | null;
     error: string | null;
+    trimmed?: ChatTrimmed;
+    status?: ChatStatus;
+    usage?: ChatUsage;
+    toolCall?: ChatToolCall;
+    toolResult?: ChatToolResult;
+    patches?: FilePatch[];
+}
+
+export interface PatchHunk {
+    oldStart: number;
+    oldLines: number;
+    newStart: number;
+    newLines: number;
+    lines: string[];
+}
+
+export interface FilePatch {
+    path: string;
+    operation: string;
+    hunks: PatchHunk[];
+    baseHash?: string;
+    valid: boolean;
+    errors?: string[];
 }
 
 export type TokenCallback = (token: string) => void;
+export type StatusCallback = (status: ChatStatus) => void;
+export type ToolCallback = (toolCall?: ChatToolCall, toolResult?: ChatToolResult) => void;
 
-function parseLines(chunk: string, tokenCallback: TokenCallback) {
+function parseLines(chunk: string, tokenCallback: TokenCallback, statusCallback?: StatusCallback, toolCallback?: ToolCallback) {
     const lines: string[] = chunk.split('\n').filter(Boolean);
     for (const line of lines) {
         if (line.trim()) {
@@ -39,6 +127,10 @@ function parseLines(chunk: string, tokenCallback: TokenCallback) {
                 break;
             } else if (streamResponse.content != null) {
                 tokenCallback(streamResponse.content);
+            } else if (streamResponse.status != null) {
+                statusCallback?.(streamResponse.status);
+            } else if (streamResponse.toolCall != null || streamResponse.toolResult != null) {
+                toolCallback?.(streamResponse.toolCall, streamResponse.toolResult);
             } else {
                 throw new Error('Unknown response stream state.');
             }
@@ -47,14 +139,14 @@ function parseLines(chunk: string, tokenCallback: TokenCallback) {
 }
 
 export default class ChatAPIClient {
-    static async sendMessage(messages: Message[], tokenCallback: TokenCallback): Promise<void> {
+    static async sendMessage(request: ChatRequest, tokenCallback: TokenCallback, statusCallback?: StatusCallback, toolCallback?: ToolCallback): Promise<void> {
         const response = await fetch(Paths.CHAT, {
             method: Methods.POST,
             headers: {
                 [Headers.CONTENT_TYPE]: Headers.APPLICATION_JSON,
                 [Headers.ACCEPT]: Headers.APPLICATION_JSON,
             },
-            body: JSON.stringify({ messages } as ChatRequest),
+            body: JSON.stringify(request),
         });
 
         if (!response.ok) {
@@ -63,7 +155,7 @@ export default class ChatAPIClient {
 
         if (!response.body) {
             const text = await response.text();
-            parseLines(text, tokenCallback)
+            parseLines(text, tokenCallback, statusCallback, toolCallback)
             return
         }
 
@@ -75,7 +167,7 @@ export default class ChatAPIClient {
                 break;
             }
             const chunk = decoder.decode(value, { stream: true });
-            parseLines(chunk, tokenCallback)
+            parseLines(chunk, tokenCallback, statusCallback, toolCallback)
         }
     }
 }
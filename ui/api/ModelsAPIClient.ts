@@ -0,0 +1,29 @@
+import {Paths} from "@/api/Paths";
+import {Headers} from "@/api/Headers";
+
+export interface Model {
+    provider: string;
+    name: string;
+    contextWindow?: number;
+    default: boolean;
+}
+
+export interface ListModelsResponse {
+    models: Model[];
+}
+
+export class ModelsAPIClient {
+    static async list(): Promise<ListModelsResponse> {
+        const response = await fetch(Paths.MODELS, {
+            headers: {
+                [Headers.ACCEPT]: Headers.APPLICATION_JSON
+            },
+        });
+        if (response.ok) {
+            const data: ListModelsResponse = await response.json();
+            return data;
+        } else {
+            throw new Error(`${response.status} ${response.statusText}`);
+        }
+    }
+}
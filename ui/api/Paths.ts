@@ -2,6 +2,7 @@ export class Paths {
     public static readonly BASE_API_URL = "http://127.0.0.1:8080/api/v1";
     public static readonly PROJECTS = `${Paths.BASE_API_URL}/projects`;
     public static readonly CHAT = `${Paths.BASE_API_URL}/chat`;
+    public static readonly MODELS = `${Paths.BASE_API_URL}/models`;
 
     public static projectId(projectId: number) {
         return `${Paths.PROJECTS}/${projectId}`;
@@ -10,4 +11,8 @@ export class Paths {
     public static amalgam(projectId: number) {
         return `${Paths.PROJECTS}/${projectId}/amalgam`;
     }
+
+    public static events(projectId: number) {
+        return `${Paths.PROJECTS}/${projectId}/events`;
+    }
 }
\ No newline at end of file
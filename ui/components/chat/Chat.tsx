@@ -3,6 +3,7 @@ import { StyleSheet, ScrollView, KeyboardAvoidingView, Platform } from 'react-na
 import { Button } from 'react-native-elements';
 import ChatAPIClient, { Message } from "@/api/ChatAPIClient";
 import ChatCard from "./ChatCard";
+import { Paths } from "@/api/Paths";
 import { amalgamSummary } from "@/components/amalgam/summary";
 import AmalgamAPIClient, { AmalgamResponse } from "@/api/AmalgamAPIClient";
 import { Roles } from "@/api/ChatAPIClient";
@@ -23,6 +24,7 @@ const Chat: React.FC<Props> = () => {
     const [messages, setMessages] = useState<Message[]>([]);
     const [loading, setLoading] = useState(false);
     const [inputValue, setInputValue] = useState('');
+    const [codebaseChanged, setCodebaseChanged] = useState(false);
 
     const fetchAmalgamData = async () => {
         setAmalgamLoading(true);
@@ -45,6 +47,20 @@ const Chat: React.FC<Props> = () => {
         fetchAmalgamData();
     }, [selectedProject?.id]);
 
+    useEffect(() => {
+        setCodebaseChanged(false);
+        if (!selectedProject || typeof EventSource === 'undefined') {
+            return;
+        }
+        const events = new EventSource(Paths.events(selectedProject.id));
+        events.addEventListener('changed', () => {
+            setCodebaseChanged(true);
+        });
+        return () => {
+            events.close();
+        };
+    }, [selectedProject?.id]);
+
     useEffect(() => {
         if (chatScrollRef.current) {
             chatScrollRef.current.scrollToEnd({ animated: true });
@@ -72,8 +88,7 @@ const Chat: React.FC<Props> = () => {
         };
 
         const apiRequestMessages = updatedMessages.map(msg => ({ role: msg.role, content: msg.content }));
-        apiRequestMessages[0].content = amalgamData?.content + "// User request below.\n\n" + apiRequestMessages[0].content;
-        await ChatAPIClient.sendMessage(apiRequestMessages, tokenCallback).catch((err) => {
+        await ChatAPIClient.sendMessage({ projectId: selectedProject?.id, messages: apiRequestMessages }, tokenCallback).catch((err) => {
             setMessages((prevMessages) =>
                 [...prevMessages, { role: Roles.ERROR, content: 'Error while sending the request: ' + err}]
             );
@@ -98,6 +113,7 @@ const Chat: React.FC<Props> = () => {
         ? "Loading codebase amalgam..."
         : amalgamData
             ? projectSummary(selectedProject) + "\n\n" + amalgamSummary(amalgamData)
+                + (codebaseChanged ? "\n\nThe codebase changed since this chat started." : "")
             : "Error loading codebase amalgam.";
 
     return (
@@ -108,7 +124,7 @@ const Chat: React.FC<Props> = () => {
                 keyboardVerticalOffset={60}
             >
                 <ThemedText type={"title"}>Codebase AI Chat</ThemedText>
-                <ThemedText style={styles.description}>This adds the codebase amalgam to the beginning of the chat.</ThemedText>
+                <ThemedText style={styles.description}>The server adds the codebase amalgam to the beginning of the chat.</ThemedText>
                 <ScrollView
                     ref={chatScrollRef}
                     style={styles.chatContainer}